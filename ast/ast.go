@@ -17,12 +17,38 @@ type Value interface {
 	valueNode()
 }
 
+// Document is a parsed file. Params are the external arguments it declares,
+// with param name or param name = default, Imports the files it binds to names
+// with import "path" as name, Exports the fields it lets importers see with
+// export name, ..., and Profiles the overlays declared with profile name
+// overlay.
 type Document struct {
-	Values []Value
+	Params     []*Parameter
+	Imports    []*Import
+	Exports    []*Identifier
+	Values     []Value
+	Profiles   []*Profile
+	Assertions []*Assertion
 }
 
 func (p *Document) String() string {
 	var out bytes.Buffer
+	for _, pa := range p.Params {
+		out.WriteString("param ")
+		out.WriteString(pa.String())
+		out.WriteString("\n")
+	}
+	for _, im := range p.Imports {
+		out.WriteString(im.String())
+		out.WriteString("\n")
+	}
+	if len(p.Exports) > 0 {
+		names := []string{}
+		for _, ex := range p.Exports {
+			names = append(names, ex.String())
+		}
+		out.WriteString("export " + strings.Join(names, ", ") + "\n")
+	}
 	for _, s := range p.Values {
 		if s != nil {
 			out.WriteString(s.String())
@@ -31,6 +57,14 @@ func (p *Document) String() string {
 			out.WriteString("nil")
 		}
 	}
+	for _, pr := range p.Profiles {
+		out.WriteString(pr.String())
+		out.WriteString("\n")
+	}
+	for _, a := range p.Assertions {
+		out.WriteString(a.String())
+		out.WriteString("\n")
+	}
 	return out.String()
 }
 
@@ -51,9 +85,12 @@ func (nv *NumberValue) valueNode()           {}
 func (nv *NumberValue) TokenLiteral() string { return nv.Token.Literal }
 func (nv *NumberValue) String() string       { return nv.Token.Literal }
 
+// StringValue is a string. Secret is set on the strings that hold a secret,
+// or are made from one, for Redact to hide them.
 type StringValue struct {
-	Token token.Token
-	Value string
+	Token  token.Token
+	Value  string
+	Secret bool
 }
 
 func (sv *StringValue) valueNode()           {}
@@ -77,6 +114,26 @@ func (bv *BooleanValue) valueNode()           {}
 func (bv *BooleanValue) TokenLiteral() string { return bv.Token.Literal }
 func (bv *BooleanValue) String() string       { return bv.Token.Literal }
 
+// NullValue is null.
+type NullValue struct {
+	Token token.Token
+}
+
+func (nv *NullValue) valueNode()           {}
+func (nv *NullValue) TokenLiteral() string { return nv.Token.Literal }
+func (nv *NullValue) String() string       { return "null" }
+
+// SpreadElement is ...value in an array literal, which splices the elements
+// of value into the array.
+type SpreadElement struct {
+	Token token.Token
+	Value Value
+}
+
+func (se *SpreadElement) valueNode()           {}
+func (se *SpreadElement) TokenLiteral() string { return se.Token.Literal }
+func (se *SpreadElement) String() string       { return "..." + se.Value.String() }
+
 type ArrayValue struct {
 	Token  token.Token
 	Values []Value
@@ -102,27 +159,151 @@ func (av *ArrayValue) String() string {
 	return out.String()
 }
 
+// MergeMode says how an attribute combines with the attribute of the same key
+// when objects are merged.
+type MergeMode int
+
+const (
+	// Objects are merged recursively, other values are replaced
+	MergeDeep MergeMode = iota
+	// key!: value replaces the previous value, even an object
+	MergeReplace
+	// key+: value is added to the previous value, appending arrays
+	MergeAppend
+)
+
+// Attribute is a key: value pair of an object. In an object literal it can
+// also be a ...spread of another object, in which case V is the spread
+// expression and Key is empty.
+//
+// Once evaluated, V is concrete whenever possible and Constraint holds the
+// constraint the field was declared with, if any, which every value that
+// overrides V must satisfy.
+//
+// A Hidden attribute, declared with key:: value, can be referred to but is
+// left out of the output.
+//
+// The key of an attribute declared with [expr]: value is Computed from expr
+// when the object literal is evaluated.
 type Attribute struct {
-	Key string
-	V   Value
+	Token    token.Token // the key token
+	Key      string
+	Computed Value
+	V        Value
+	Merge    MergeMode
+	Spread   bool
+	Hidden   bool
+
+	Constraint Value
 }
 
 func (a *Attribute) String() string {
 	var out bytes.Buffer
 
-	out.WriteString("\"")
-	out.WriteString(a.Key)
-	out.WriteString("\"")
+	if a.Spread {
+		return "..." + a.V.String()
+	}
+
+	if a.Computed != nil {
+		out.WriteString("[" + a.Computed.String() + "]")
+	} else {
+		out.WriteString("\"")
+		out.WriteString(Escape(a.Key))
+		out.WriteString("\"")
+	}
 
 	out.WriteString(":")
+	if a.Hidden {
+		out.WriteString(":")
+	}
 	out.WriteString(a.V.String())
 
 	return out.String()
 }
 
+// Import is import "path" as name, which binds name to the value of the file
+// at Path in the whole document.
+type Import struct {
+	Token token.Token
+	Path  *StringValue
+	Name  *Identifier
+}
+
+func (im *Import) TokenLiteral() string { return im.Token.Literal }
+func (im *Import) String() string {
+	return "import " + im.Path.String() + " as " + im.Name.String()
+}
+
+// Profile is profile name overlay, an object merged into the result of a
+// document when the profile is selected.
+type Profile struct {
+	Token   token.Token
+	Name    *Identifier
+	Overlay Value
+}
+
+func (pr *Profile) TokenLiteral() string { return pr.Token.Literal }
+func (pr *Profile) String() string {
+	return "profile " + pr.Name.String() + " " + pr.Overlay.String()
+}
+
+// Assertion is assert condition : message. Message is nil when it is left
+// out.
+type Assertion struct {
+	Token     token.Token
+	Condition Value
+	Message   Value
+}
+
+func (a *Assertion) TokenLiteral() string { return a.Token.Literal }
+func (a *Assertion) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("assert ")
+	out.WriteString(a.Condition.String())
+	if a.Message != nil {
+		out.WriteString(" : ")
+		out.WriteString(a.Message.String())
+	}
+
+	return out.String()
+}
+
+// Pattern is [name=constraint]: value, a default merged into every field of an
+// object literal whose key satisfies Constraint. Name, which can be left out,
+// is bound to the key of the field in Value.
+type Pattern struct {
+	Token      token.Token
+	Name       *Identifier
+	Constraint Value
+	Value      Value
+}
+
+func (pa *Pattern) TokenLiteral() string { return pa.Token.Literal }
+func (pa *Pattern) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("[")
+	if pa.Name != nil {
+		out.WriteString(pa.Name.String() + "=")
+	}
+	out.WriteString(pa.Constraint.String())
+	out.WriteString("]:")
+	out.WriteString(pa.Value.String())
+
+	return out.String()
+}
+
+// ObjectValue is an object. The Assertions and Patterns of an object literal
+// are applied when it is evaluated and are not kept in the result. Late is set
+// on an object literal whose fields refer to self or super, which are bound
+// when it is evaluated and again each time it is merged.
 type ObjectValue struct {
 	Token      token.Token
 	Attributes []Attribute
+	Assertions []*Assertion
+	Patterns   []*Pattern
+	Late       bool
 }
 
 func (ov *ObjectValue) valueNode()           {}
@@ -134,9 +315,314 @@ func (ov *ObjectValue) String() string {
 	for _, e := range ov.Attributes {
 		elements = append(elements, e.String())
 	}
+	for _, a := range ov.Assertions {
+		elements = append(elements, a.String())
+	}
+	for _, pa := range ov.Patterns {
+		elements = append(elements, pa.String())
+	}
 
 	out.WriteString("{")
 	out.WriteString(strings.Join(elements, ", "))
 	out.WriteString("}")
 	return out.String()
 }
+
+type Identifier struct {
+	Token token.Token
+	Value string
+}
+
+func (i *Identifier) valueNode()           {}
+func (i *Identifier) TokenLiteral() string { return i.Token.Literal }
+func (i *Identifier) String() string       { return i.Value }
+
+type PrefixExpression struct {
+	Token    token.Token
+	Operator string
+	Right    Value
+}
+
+func (pe *PrefixExpression) valueNode()           {}
+func (pe *PrefixExpression) TokenLiteral() string { return pe.Token.Literal }
+func (pe *PrefixExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(pe.Operator)
+	out.WriteString(pe.Right.String())
+	out.WriteString(")")
+
+	return out.String()
+}
+
+type InfixExpression struct {
+	Token    token.Token
+	Left     Value
+	Operator string
+	Right    Value
+}
+
+func (ie *InfixExpression) valueNode()           {}
+func (ie *InfixExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *InfixExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(ie.Left.String())
+	out.WriteString(" " + ie.Operator + " ")
+	out.WriteString(ie.Right.String())
+	out.WriteString(")")
+
+	return out.String()
+}
+
+// MemberExpression selects the field Property of the object Object (a.b). An
+// Optional selection (a?.b) is null when Object is null or has no such field.
+type MemberExpression struct {
+	Token    token.Token
+	Object   Value
+	Property *Identifier
+	Optional bool
+}
+
+func (me *MemberExpression) valueNode()           {}
+func (me *MemberExpression) TokenLiteral() string { return me.Token.Literal }
+func (me *MemberExpression) String() string {
+	if me.Optional {
+		return me.Object.String() + "?." + me.Property.String()
+	}
+	return me.Object.String() + "." + me.Property.String()
+}
+
+// IndexExpression selects an element of an array, a code point of a string or
+// a field of an object (a[i]). An Optional index (a?.[i]) is null when Left is
+// null or has no such element.
+type IndexExpression struct {
+	Token    token.Token
+	Left     Value
+	Index    Value
+	Optional bool
+}
+
+func (ie *IndexExpression) valueNode()           {}
+func (ie *IndexExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IndexExpression) String() string {
+	if ie.Optional {
+		return ie.Left.String() + "?.[" + ie.Index.String() + "]"
+	}
+	return ie.Left.String() + "[" + ie.Index.String() + "]"
+}
+
+// SliceExpression is a[low:high], the elements of an array or the code points
+// of a string from low up to, not including, high. Low and High are nil when
+// they are left out.
+type SliceExpression struct {
+	Token token.Token
+	Left  Value
+	Low   Value
+	High  Value
+}
+
+func (se *SliceExpression) valueNode()           {}
+func (se *SliceExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SliceExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString(se.Left.String() + "[")
+	if se.Low != nil {
+		out.WriteString(se.Low.String())
+	}
+	out.WriteString(":")
+	if se.High != nil {
+		out.WriteString(se.High.String())
+	}
+	out.WriteString("]")
+	return out.String()
+}
+
+// ForClause is the "for k, v in iterable" header of a comprehension, with its
+// optional trailing "if" filter. Key is nil when a single variable is given.
+type ForClause struct {
+	Token    token.Token
+	Key      *Identifier
+	Value    *Identifier
+	Iterable Value
+	Filter   Value
+}
+
+func (fc *ForClause) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("for ")
+	if fc.Key != nil {
+		out.WriteString(fc.Key.String())
+		out.WriteString(", ")
+	}
+	out.WriteString(fc.Value.String())
+	out.WriteString(" in ")
+	out.WriteString(fc.Iterable.String())
+
+	return out.String()
+}
+
+func (fc *ForClause) filterString() string {
+	if fc.Filter == nil {
+		return ""
+	}
+	return " if " + fc.Filter.String()
+}
+
+// ArrayComprehension is [for x in list: expr if cond]. It evaluates to an
+// ArrayValue.
+type ArrayComprehension struct {
+	Token token.Token
+	For   *ForClause
+	Body  Value
+}
+
+func (ac *ArrayComprehension) valueNode()           {}
+func (ac *ArrayComprehension) TokenLiteral() string { return ac.Token.Literal }
+func (ac *ArrayComprehension) String() string {
+	return "[" + ac.For.String() + ": " + ac.Body.String() + ac.For.filterString() + "]"
+}
+
+// ObjectComprehension is {for k, v in obj: key: value if cond}. It evaluates
+// to an ObjectValue.
+type ObjectComprehension struct {
+	Token token.Token
+	For   *ForClause
+	Key   Value
+	Body  Value
+}
+
+func (oc *ObjectComprehension) valueNode()           {}
+func (oc *ObjectComprehension) TokenLiteral() string { return oc.Token.Literal }
+func (oc *ObjectComprehension) String() string {
+	return "{" + oc.For.String() + ": " + oc.Key.String() + ":" + oc.Body.String() +
+		oc.For.filterString() + "}"
+}
+
+// IfExpression is "if cond then a else b".
+type IfExpression struct {
+	Token       token.Token
+	Condition   Value
+	Consequence Value
+	Alternative Value
+}
+
+func (ie *IfExpression) valueNode()           {}
+func (ie *IfExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IfExpression) String() string {
+	return "if " + ie.Condition.String() + " then " + ie.Consequence.String() +
+		" else " + ie.Alternative.String()
+}
+
+// TryExpression is try value else fallback, or try value as name else
+// fallback to bind name to the message of the error in fallback.
+type TryExpression struct {
+	Token    token.Token
+	Value    Value
+	Name     *Identifier
+	Fallback Value
+}
+
+func (te *TryExpression) valueNode()           {}
+func (te *TryExpression) TokenLiteral() string { return te.Token.Literal }
+func (te *TryExpression) String() string {
+	if te.Name != nil {
+		return "try " + te.Value.String() + " as " + te.Name.String() + " else " + te.Fallback.String()
+	}
+	return "try " + te.Value.String() + " else " + te.Fallback.String()
+}
+
+// Parameter is a function parameter. Default is nil when the parameter is
+// required.
+type Parameter struct {
+	Name    *Identifier
+	Default Value
+}
+
+func (pa *Parameter) String() string {
+	if pa.Default == nil {
+		return pa.Name.String()
+	}
+	return pa.Name.String() + " = " + pa.Default.String()
+}
+
+type FunctionLiteral struct {
+	Token      token.Token
+	Parameters []*Parameter
+	Body       Value
+}
+
+func (fl *FunctionLiteral) valueNode()           {}
+func (fl *FunctionLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FunctionLiteral) String() string {
+	params := []string{}
+	for _, p := range fl.Parameters {
+		params = append(params, p.String())
+	}
+
+	return "function(" + strings.Join(params, ", ") + ") " + fl.Body.String()
+}
+
+// Argument is a call argument. Name is nil for positional arguments.
+type Argument struct {
+	Name  *Identifier
+	Value Value
+}
+
+func (a *Argument) String() string {
+	if a.Name == nil {
+		return a.Value.String()
+	}
+	return a.Name.String() + " = " + a.Value.String()
+}
+
+type CallExpression struct {
+	Token     token.Token // the '(' token
+	Function  Value
+	Arguments []*Argument
+}
+
+func (ce *CallExpression) valueNode()           {}
+func (ce *CallExpression) TokenLiteral() string { return ce.Token.Literal }
+func (ce *CallExpression) String() string {
+	args := []string{}
+	for _, a := range ce.Arguments {
+		args = append(args, a.String())
+	}
+
+	return ce.Function.String() + "(" + strings.Join(args, ", ") + ")"
+}
+
+// SelfExpression is self, the object literal it is written in, with the
+// fields of the objects merged into it.
+type SelfExpression struct {
+	Token token.Token
+}
+
+func (se *SelfExpression) valueNode()           {}
+func (se *SelfExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SelfExpression) String() string       { return "self" }
+
+// SuperExpression is super, the object that the object literal it is written
+// in was merged into.
+type SuperExpression struct {
+	Token token.Token
+}
+
+func (se *SuperExpression) valueNode()           {}
+func (se *SuperExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SuperExpression) String() string       { return "super" }
+
+// ImportExpression is import "path". It evaluates to the value of the file at
+// Path.
+type ImportExpression struct {
+	Token token.Token
+	Path  *StringValue
+}
+
+func (ie *ImportExpression) valueNode()           {}
+func (ie *ImportExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *ImportExpression) String() string       { return "import " + ie.Path.String() }
@@ -0,0 +1,104 @@
+package ast
+
+import (
+	"strings"
+
+	"github.com/salleaffaire/ynt/token"
+)
+
+// BoundExpression is a comparison operator applied to a single value, such as
+// >=1 or != "". It evaluates to a BoundConstraint.
+type BoundExpression struct {
+	Token    token.Token
+	Operator string
+	Value    Value
+}
+
+func (be *BoundExpression) valueNode()           {}
+func (be *BoundExpression) TokenLiteral() string { return be.Token.Literal }
+func (be *BoundExpression) String() string       { return be.Operator + be.Value.String() }
+
+// DefaultExpression is *value. It marks the default of a disjunction.
+type DefaultExpression struct {
+	Token token.Token
+	Value Value
+}
+
+func (de *DefaultExpression) valueNode()           {}
+func (de *DefaultExpression) TokenLiteral() string { return de.Token.Literal }
+func (de *DefaultExpression) String() string       { return "*" + de.Value.String() }
+
+// The following values only exist during evaluation. A constraint stands for
+// the set of values that satisfy it.
+
+// TypeConstraint is satisfied by the values of a type: int, number, string,
+// boolean, array or object.
+type TypeConstraint struct {
+	Token token.Token
+	Name  string
+}
+
+func (tc *TypeConstraint) valueNode()           {}
+func (tc *TypeConstraint) TokenLiteral() string { return tc.Token.Literal }
+func (tc *TypeConstraint) String() string       { return tc.Name }
+
+// BoundConstraint is satisfied by the values v for which "v Operator Bound"
+// holds.
+type BoundConstraint struct {
+	Token    token.Token
+	Operator string
+	Bound    Value
+}
+
+func (bc *BoundConstraint) valueNode()           {}
+func (bc *BoundConstraint) TokenLiteral() string { return bc.Token.Literal }
+func (bc *BoundConstraint) String() string       { return bc.Operator + bc.Bound.String() }
+
+// Disjunction (a | b) is satisfied by the values that are equal to, or
+// satisfy, one of Alternatives. Default is the alternative marked with *, if
+// any.
+type Disjunction struct {
+	Token        token.Token
+	Alternatives []Value
+	Default      Value
+}
+
+func (d *Disjunction) valueNode()           {}
+func (d *Disjunction) TokenLiteral() string { return d.Token.Literal }
+func (d *Disjunction) String() string {
+	alternatives := []string{}
+	for _, a := range d.Alternatives {
+		if a == d.Default {
+			alternatives = append(alternatives, "*"+a.String())
+		} else {
+			alternatives = append(alternatives, a.String())
+		}
+	}
+	return strings.Join(alternatives, " | ")
+}
+
+// Conjunction (a & b) is satisfied by the values that satisfy all of
+// Constraints. Value is the concrete value the constraints were unified with,
+// if any.
+type Conjunction struct {
+	Token       token.Token
+	Constraints []Value
+	Value       Value
+}
+
+func (c *Conjunction) valueNode()           {}
+func (c *Conjunction) TokenLiteral() string { return c.Token.Literal }
+func (c *Conjunction) String() string {
+	conjuncts := []string{}
+	for _, cc := range c.Constraints {
+		s := cc.String()
+		if _, ok := cc.(*Disjunction); ok {
+			s = "(" + s + ")"
+		}
+		conjuncts = append(conjuncts, s)
+	}
+	if c.Value != nil {
+		conjuncts = append(conjuncts, c.Value.String())
+	}
+	return strings.Join(conjuncts, " & ")
+}
@@ -0,0 +1,83 @@
+package ast
+
+// Redacted replaces secret strings in the values returned by Redact.
+const Redacted = "<redacted>"
+
+// Redact returns v with the strings marked Secret replaced by Redacted,
+// including those of constraints, so that it can be logged or shown.
+func Redact(v Value) Value {
+	switch v := v.(type) {
+	case *StringValue:
+		if !v.Secret {
+			return v
+		}
+		tok := v.Token
+		tok.Literal = Redacted
+		return &StringValue{Token: tok, Value: Redacted}
+
+	case *ArrayValue:
+		result := &ArrayValue{Token: v.Token, Values: make([]Value, 0, len(v.Values))}
+		for _, e := range v.Values {
+			result.Values = append(result.Values, Redact(e))
+		}
+		return result
+
+	case *ObjectValue:
+		result := &ObjectValue{Token: v.Token, Attributes: make([]Attribute, 0, len(v.Attributes))}
+		for _, att := range v.Attributes {
+			att.V = Redact(att.V)
+			result.Attributes = append(result.Attributes, att)
+		}
+		return result
+
+	case *BoundConstraint:
+		return &BoundConstraint{Token: v.Token, Operator: v.Operator, Bound: Redact(v.Bound)}
+
+	case *Disjunction:
+		result := &Disjunction{Token: v.Token, Alternatives: make([]Value, 0, len(v.Alternatives))}
+		for _, a := range v.Alternatives {
+			ra := Redact(a)
+			if a == v.Default {
+				result.Default = ra
+			}
+			result.Alternatives = append(result.Alternatives, ra)
+		}
+		if v.Default != nil && result.Default == nil {
+			result.Default = Redact(v.Default)
+		}
+		return result
+
+	case *Conjunction:
+		result := &Conjunction{Token: v.Token, Constraints: make([]Value, 0, len(v.Constraints))}
+		for _, c := range v.Constraints {
+			result.Constraints = append(result.Constraints, Redact(c))
+		}
+		if v.Value != nil {
+			result.Value = Redact(v.Value)
+		}
+		return result
+	}
+
+	return v
+}
+
+// HasSecret reports whether v holds a string marked Secret.
+func HasSecret(v Value) bool {
+	switch v := v.(type) {
+	case *StringValue:
+		return v.Secret
+	case *ArrayValue:
+		for _, e := range v.Values {
+			if HasSecret(e) {
+				return true
+			}
+		}
+	case *ObjectValue:
+		for _, att := range v.Attributes {
+			if HasSecret(att.V) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,18 @@
+package ast
+
+import (
+	"regexp"
+
+	"github.com/salleaffaire/ynt/token"
+)
+
+// RegexValue is a regular expression literal, such as re"^v\d+$", with the
+// RE2 syntax of package regexp. The pattern is compiled when it is parsed.
+type RegexValue struct {
+	Token  token.Token
+	Regexp *regexp.Regexp
+}
+
+func (rv *RegexValue) valueNode()           {}
+func (rv *RegexValue) TokenLiteral() string { return rv.Token.Literal }
+func (rv *RegexValue) String() string       { return `re"` + rv.Token.Literal + `"` }
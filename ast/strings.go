@@ -0,0 +1,68 @@
+package ast
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Escape returns s as it is written between the quotes of a JSON string.
+func Escape(s string) string {
+	var out bytes.Buffer
+
+	for _, r := range s {
+		switch r {
+		case '"':
+			out.WriteString(`\"`)
+		case '\\':
+			out.WriteString(`\\`)
+		case '\b':
+			out.WriteString(`\b`)
+		case '\f':
+			out.WriteString(`\f`)
+		case '\n':
+			out.WriteString(`\n`)
+		case '\r':
+			out.WriteString(`\r`)
+		case '\t':
+			out.WriteString(`\t`)
+		default:
+			if r < 0x20 {
+				fmt.Fprintf(&out, `\u%04x`, r)
+			} else {
+				out.WriteRune(r)
+			}
+		}
+	}
+
+	return out.String()
+}
+
+// Unescape returns the string written as s between the quotes of a JSON
+// string.
+func Unescape(s string) string {
+	var out bytes.Buffer
+
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			out.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'b':
+			out.WriteByte('\b')
+		case 'f':
+			out.WriteByte('\f')
+		case 'n':
+			out.WriteByte('\n')
+		case 'r':
+			out.WriteByte('\r')
+		case 't':
+			out.WriteByte('\t')
+		default:
+			out.WriteByte(s[i])
+		}
+	}
+
+	return out.String()
+}
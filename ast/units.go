@@ -0,0 +1,87 @@
+package ast
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/salleaffaire/ynt/token"
+)
+
+// DurationValue is a duration such as 1h30m.
+type DurationValue struct {
+	Token token.Token
+	Value time.Duration
+}
+
+func (dv *DurationValue) valueNode()           {}
+func (dv *DurationValue) TokenLiteral() string { return dv.Token.Literal }
+func (dv *DurationValue) String() string       { return dv.Token.Literal }
+
+// ByteSizeValue is a number of bytes, such as 512MiB.
+type ByteSizeValue struct {
+	Token token.Token
+	Value int64
+}
+
+func (bv *ByteSizeValue) valueNode()           {}
+func (bv *ByteSizeValue) TokenLiteral() string { return bv.Token.Literal }
+func (bv *ByteSizeValue) String() string       { return bv.Token.Literal }
+
+// TimestampValue is an RFC 3339 timestamp, such as 2026-01-01T00:00:00Z.
+type TimestampValue struct {
+	Token token.Token
+	Value time.Time
+}
+
+func (tv *TimestampValue) valueNode()           {}
+func (tv *TimestampValue) TokenLiteral() string { return tv.Token.Literal }
+func (tv *TimestampValue) String() string       { return tv.Token.Literal }
+
+// ByteSizeUnits are the units of byte sizes, with their number of bytes.
+var ByteSizeUnits = map[string]int64{
+	"B":   1,
+	"KB":  1000,
+	"MB":  1000 * 1000,
+	"GB":  1000 * 1000 * 1000,
+	"TB":  1000 * 1000 * 1000 * 1000,
+	"PB":  1000 * 1000 * 1000 * 1000 * 1000,
+	"KiB": 1 << 10,
+	"MiB": 1 << 20,
+	"GiB": 1 << 30,
+	"TiB": 1 << 40,
+	"PiB": 1 << 50,
+}
+
+// ParseByteSize parses a byte size made of a number and a unit of
+// ByteSizeUnits, such as 512MiB or 1.5GB.
+func ParseByteSize(s string) (int64, error) {
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z')
+	})
+	if i <= 0 {
+		return 0, fmt.Errorf("invalid byte size %s", s)
+	}
+
+	unit, ok := ByteSizeUnits[s[i:]]
+	if !ok {
+		return 0, fmt.Errorf("unknown unit %s in byte size %s", s[i:], s)
+	}
+	n, err := strconv.ParseFloat(s[:i], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid byte size %s", s)
+	}
+
+	return int64(n * float64(unit)), nil
+}
+
+// FormatByteSize returns n bytes in the largest binary unit that divides it.
+func FormatByteSize(n int64) string {
+	for _, unit := range []string{"PiB", "TiB", "GiB", "MiB", "KiB"} {
+		if size := ByteSizeUnits[unit]; n != 0 && n%size == 0 {
+			return strconv.FormatInt(n/size, 10) + unit
+		}
+	}
+	return strconv.FormatInt(n, 10) + "B"
+}
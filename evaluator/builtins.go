@@ -0,0 +1,541 @@
+package evaluator
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"regexp/syntax"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/salleaffaire/ynt/ast"
+	"github.com/salleaffaire/ynt/token"
+)
+
+// Builtin is a function provided by the evaluator rather than written in the
+// document. Builtins are resolved after every binding of the document, so a
+// field or parameter with the same name shadows them.
+type Builtin struct {
+	*ast.Identifier
+
+	// Signature documents the function, e.g. "split(s string, sep string)
+	// array". Parameter types are the names returned by typeName, with
+	// alternatives separated by "|". "any" accepts every value, and a type
+	// starting with "..." accepts any number of trailing arguments.
+	Signature string
+
+	params []builtinParam
+	rest   *builtinParam
+
+	Fn func(e *Evaluator, tok token.Token, args []ast.Value) (ast.Value, error)
+}
+
+type builtinParam struct {
+	name  string
+	types []string
+}
+
+func (bp builtinParam) accepts(v ast.Value) bool {
+	for _, t := range bp.types {
+		if t == "any" || t == typeName(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// newBuiltin returns the builtin described by signature.
+func newBuiltin(signature string, fn func(*Evaluator, token.Token, []ast.Value) (ast.Value, error)) *Builtin {
+	start := strings.Index(signature, "(")
+	end := strings.LastIndex(signature, ")")
+	name := signature[:start]
+
+	b := &Builtin{
+		Identifier: &ast.Identifier{Token: token.Token{Type: token.IDENT, Literal: name}, Value: name},
+		Signature:  signature,
+		Fn:         fn,
+	}
+
+	if params := signature[start+1 : end]; params != "" {
+		for _, p := range strings.Split(params, ", ") {
+			fields := strings.Fields(p)
+			param := builtinParam{name: fields[0], types: strings.Split(strings.TrimPrefix(fields[1], "..."), "|")}
+			if strings.HasPrefix(fields[1], "...") {
+				b.rest = &param
+			} else {
+				b.params = append(b.params, param)
+			}
+		}
+	}
+
+	return b
+}
+
+// checkArguments verifies the number and the types of args.
+func (b *Builtin) checkArguments(tok token.Token, args []ast.Value) error {
+	if len(args) < len(b.params) || (b.rest == nil && len(args) > len(b.params)) {
+		return newError(tok, "wrong number of arguments to %s: got %d, want %s", b.Value, len(args), b.Signature)
+	}
+
+	for i, arg := range args {
+		param := b.rest
+		if i < len(b.params) {
+			param = &b.params[i]
+		}
+		if !param.accepts(arg) {
+			return newError(tok, "argument %s of %s must be %s, got %s",
+				param.name, b.Value, strings.Join(param.types, " or "), typeName(arg))
+		}
+	}
+
+	return nil
+}
+
+// builtins is the standard library.
+var builtins = []*Builtin{
+	// Strings
+	newBuiltin("upper(s string) string", func(e *Evaluator, tok token.Token, args []ast.Value) (ast.Value, error) {
+		return newString(tok, strings.ToUpper(stringArg(args[0]))), nil
+	}),
+	newBuiltin("lower(s string) string", func(e *Evaluator, tok token.Token, args []ast.Value) (ast.Value, error) {
+		return newString(tok, strings.ToLower(stringArg(args[0]))), nil
+	}),
+	newBuiltin("trim(s string) string", func(e *Evaluator, tok token.Token, args []ast.Value) (ast.Value, error) {
+		return newString(tok, strings.TrimSpace(stringArg(args[0]))), nil
+	}),
+	newBuiltin("split(s string, sep string) array", func(e *Evaluator, tok token.Token, args []ast.Value) (ast.Value, error) {
+		result := &ast.ArrayValue{Token: tok, Values: []ast.Value{}}
+		for _, part := range strings.Split(stringArg(args[0]), stringArg(args[1])) {
+			result.Values = append(result.Values, newString(tok, part))
+		}
+		return result, nil
+	}),
+	newBuiltin("join(list array, sep string) string", func(e *Evaluator, tok token.Token, args []ast.Value) (ast.Value, error) {
+		parts := []string{}
+		for _, v := range args[0].(*ast.ArrayValue).Values {
+			s, ok := v.(*ast.StringValue)
+			if !ok {
+				return nil, newError(tok, "join: elements must be strings, got %s", typeName(v))
+			}
+			parts = append(parts, s.Value)
+		}
+		return newString(tok, strings.Join(parts, stringArg(args[1]))), nil
+	}),
+	newBuiltin("replace(s string, old string|regex, new string) string", func(e *Evaluator, tok token.Token, args []ast.Value) (ast.Value, error) {
+		if re, ok := args[1].(*ast.RegexValue); ok {
+			return newString(tok, re.Regexp.ReplaceAllString(stringArg(args[0]), stringArg(args[2]))), nil
+		}
+		return newString(tok, strings.ReplaceAll(stringArg(args[0]), stringArg(args[1]), stringArg(args[2]))), nil
+	}),
+	newBuiltin("format(format string, args ...any) string", func(e *Evaluator, tok token.Token, args []ast.Value) (ast.Value, error) {
+		return formatString(tok, args[0].(*ast.StringValue), args[1:])
+	}),
+
+	// Regular expressions
+	newBuiltin("matches(s string, pattern regex|string) boolean", func(e *Evaluator, tok token.Token, args []ast.Value) (ast.Value, error) {
+		re, err := regexArg(tok, "matches", args[1])
+		if err != nil {
+			return nil, err
+		}
+		return newBoolean(tok, re.MatchString(stringArg(args[0]))), nil
+	}),
+	newBuiltin("find(s string, pattern regex|string) array", func(e *Evaluator, tok token.Token, args []ast.Value) (ast.Value, error) {
+		re, err := regexArg(tok, "find", args[1])
+		if err != nil {
+			return nil, err
+		}
+		result := &ast.ArrayValue{Token: tok, Values: []ast.Value{}}
+		for _, m := range re.FindAllString(stringArg(args[0]), -1) {
+			result.Values = append(result.Values, newString(tok, m))
+		}
+		return result, nil
+	}),
+	newBuiltin("captures(s string, pattern regex|string) array|object", func(e *Evaluator, tok token.Token, args []ast.Value) (ast.Value, error) {
+		re, err := regexArg(tok, "captures", args[1])
+		if err != nil {
+			return nil, err
+		}
+		return captures(tok, re, stringArg(args[0])), nil
+	}),
+
+	// Encoding and hashing
+	newBuiltin("base64Encode(s string) string", func(e *Evaluator, tok token.Token, args []ast.Value) (ast.Value, error) {
+		return newString(tok, base64.StdEncoding.EncodeToString([]byte(stringArg(args[0])))), nil
+	}),
+	newBuiltin("base64Decode(s string) string", func(e *Evaluator, tok token.Token, args []ast.Value) (ast.Value, error) {
+		b, err := base64.StdEncoding.DecodeString(stringArg(args[0]))
+		if err != nil {
+			return nil, newError(tok, "base64Decode: invalid base64 %s", show(args[0]))
+		}
+		return decodedString(tok, "base64Decode", b)
+	}),
+	newBuiltin("hexEncode(s string) string", func(e *Evaluator, tok token.Token, args []ast.Value) (ast.Value, error) {
+		return newString(tok, hex.EncodeToString([]byte(stringArg(args[0])))), nil
+	}),
+	newBuiltin("hexDecode(s string) string", func(e *Evaluator, tok token.Token, args []ast.Value) (ast.Value, error) {
+		b, err := hex.DecodeString(stringArg(args[0]))
+		if err != nil {
+			return nil, newError(tok, "hexDecode: invalid hex %s", show(args[0]))
+		}
+		return decodedString(tok, "hexDecode", b)
+	}),
+	newBuiltin("sha1(v any) string", hashBuiltin(sha1.New)),
+	newBuiltin("sha256(v any) string", hashBuiltin(sha256.New)),
+	newBuiltin("sha512(v any) string", hashBuiltin(sha512.New)),
+	newBuiltin("uuidv5(namespace string, name any) string", func(e *Evaluator, tok token.Token, args []ast.Value) (ast.Value, error) {
+		b, err := hashable(args[1])
+		if err != nil {
+			return nil, err
+		}
+		return uuidv5(tok, args[0].(*ast.StringValue), b)
+	}),
+
+	// Math
+	newBuiltin("min(a number, rest ...number) number", func(e *Evaluator, tok token.Token, args []ast.Value) (ast.Value, error) {
+		result := numberArg(args[0])
+		for _, v := range args[1:] {
+			result = math.Min(result, numberArg(v))
+		}
+		return newNumber(tok, result), nil
+	}),
+	newBuiltin("max(a number, rest ...number) number", func(e *Evaluator, tok token.Token, args []ast.Value) (ast.Value, error) {
+		result := numberArg(args[0])
+		for _, v := range args[1:] {
+			result = math.Max(result, numberArg(v))
+		}
+		return newNumber(tok, result), nil
+	}),
+	newBuiltin("floor(n number) number", func(e *Evaluator, tok token.Token, args []ast.Value) (ast.Value, error) {
+		return newNumber(tok, math.Floor(numberArg(args[0]))), nil
+	}),
+	newBuiltin("ceil(n number) number", func(e *Evaluator, tok token.Token, args []ast.Value) (ast.Value, error) {
+		return newNumber(tok, math.Ceil(numberArg(args[0]))), nil
+	}),
+	newBuiltin("abs(n number) number", func(e *Evaluator, tok token.Token, args []ast.Value) (ast.Value, error) {
+		return newNumber(tok, math.Abs(numberArg(args[0]))), nil
+	}),
+
+	// Collections
+	newBuiltin("length(v string|array|object) number", func(e *Evaluator, tok token.Token, args []ast.Value) (ast.Value, error) {
+		switch v := args[0].(type) {
+		case *ast.StringValue:
+			return newNumber(tok, float64(utf8.RuneCountInString(v.Value))), nil
+		case *ast.ArrayValue:
+			return newNumber(tok, float64(len(v.Values))), nil
+		default:
+			return newNumber(tok, float64(len(visibleAttributes(v.(*ast.ObjectValue))))), nil
+		}
+	}),
+	newBuiltin("keys(o object) array", func(e *Evaluator, tok token.Token, args []ast.Value) (ast.Value, error) {
+		result := &ast.ArrayValue{Token: tok, Values: []ast.Value{}}
+		for _, att := range visibleAttributes(args[0].(*ast.ObjectValue)) {
+			result.Values = append(result.Values, newString(tok, att.Key))
+		}
+		return result, nil
+	}),
+	newBuiltin("values(o object) array", func(e *Evaluator, tok token.Token, args []ast.Value) (ast.Value, error) {
+		result := &ast.ArrayValue{Token: tok, Values: []ast.Value{}}
+		for _, att := range visibleAttributes(args[0].(*ast.ObjectValue)) {
+			result.Values = append(result.Values, att.V)
+		}
+		return result, nil
+	}),
+	newBuiltin("sort(list array) array", func(e *Evaluator, tok token.Token, args []ast.Value) (ast.Value, error) {
+		values := append([]ast.Value{}, args[0].(*ast.ArrayValue).Values...)
+		var err error
+		sort.SliceStable(values, func(i, j int) bool {
+			less, ok := lessThan(values[i], values[j])
+			if !ok && err == nil {
+				err = newError(tok, "sort: cannot compare %s and %s", typeName(values[i]), typeName(values[j]))
+			}
+			return less
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &ast.ArrayValue{Token: tok, Values: values}, nil
+	}),
+	newBuiltin("uniq(list array) array", func(e *Evaluator, tok token.Token, args []ast.Value) (ast.Value, error) {
+		result := &ast.ArrayValue{Token: tok, Values: []ast.Value{}}
+		for _, v := range args[0].(*ast.ArrayValue).Values {
+			if !contains(result.Values, v) {
+				result.Values = append(result.Values, v)
+			}
+		}
+		return result, nil
+	}),
+	newBuiltin("flatten(list array) array", func(e *Evaluator, tok token.Token, args []ast.Value) (ast.Value, error) {
+		result := &ast.ArrayValue{Token: tok, Values: []ast.Value{}}
+		for _, v := range args[0].(*ast.ArrayValue).Values {
+			if inner, ok := v.(*ast.ArrayValue); ok {
+				result.Values = append(result.Values, inner.Values...)
+			} else {
+				result.Values = append(result.Values, v)
+			}
+		}
+		return result, nil
+	}),
+	newBuiltin("range(from number, to number) array", func(e *Evaluator, tok token.Token, args []ast.Value) (ast.Value, error) {
+		result := &ast.ArrayValue{Token: tok, Values: []ast.Value{}}
+		for n := numberArg(args[0]); n < numberArg(args[1]); n++ {
+			if err := e.step(tok); err != nil {
+				return nil, err
+			}
+			result.Values = append(result.Values, newNumber(tok, n))
+		}
+		return result, nil
+	}),
+	newBuiltin("zip(a array, b array) array", func(e *Evaluator, tok token.Token, args []ast.Value) (ast.Value, error) {
+		a, b := args[0].(*ast.ArrayValue).Values, args[1].(*ast.ArrayValue).Values
+		result := &ast.ArrayValue{Token: tok, Values: []ast.Value{}}
+		for i := 0; i < len(a) && i < len(b); i++ {
+			result.Values = append(result.Values, &ast.ArrayValue{Token: tok, Values: []ast.Value{a[i], b[i]}})
+		}
+		return result, nil
+	}),
+
+	// Environment
+	newBuiltin("env(name string, default ...string) string", func(e *Evaluator, tok token.Token, args []ast.Value) (ast.Value, error) {
+		if len(args) > 2 {
+			return nil, newError(tok, "wrong number of arguments to env: got %d, want env(name string, default ...string) string", len(args))
+		}
+		return e.lookupEnv(tok, args[0].(*ast.StringValue), args[1:])
+	}),
+
+	// Secrets
+	newBuiltin("secret(name string) string", func(e *Evaluator, tok token.Token, args []ast.Value) (ast.Value, error) {
+		return e.lookupSecret(tok, args[0].(*ast.StringValue))
+	}),
+
+	// Types
+	newBuiltin("error(message string) any", func(e *Evaluator, tok token.Token, args []ast.Value) (ast.Value, error) {
+		message := args[0].(*ast.StringValue)
+		if message.Secret {
+			return nil, newError(tok, "%s", ast.Redacted)
+		}
+		return nil, newError(tok, "%s", message.Value)
+	}),
+	newBuiltin("isNumber(v any) boolean", isType("number")),
+	newBuiltin("isString(v any) boolean", isType("string")),
+	newBuiltin("isBoolean(v any) boolean", isType("boolean")),
+	newBuiltin("isArray(v any) boolean", isType("array")),
+	newBuiltin("isObject(v any) boolean", isType("object")),
+	newBuiltin("isFunction(v any) boolean", isType("function")),
+}
+
+// builtinEnv is the outermost environment of every evaluation.
+var builtinEnv = newBuiltinEnvironment()
+
+func newBuiltinEnvironment() *Environment {
+	env := NewEnvironment()
+	for _, b := range builtins {
+		env.Set(b.Value, b)
+	}
+	for _, name := range typeConstraints {
+		env.Set(name, &ast.TypeConstraint{Token: token.Token{Type: token.IDENT, Literal: name}, Name: name})
+	}
+	return env
+}
+
+func isType(name string) func(*Evaluator, token.Token, []ast.Value) (ast.Value, error) {
+	return func(e *Evaluator, tok token.Token, args []ast.Value) (ast.Value, error) {
+		return newBoolean(tok, typeName(args[0]) == name), nil
+	}
+}
+
+func stringArg(v ast.Value) string {
+	return v.(*ast.StringValue).Value
+}
+
+// regexArg returns the regex v, or compiles the pattern v of a string. fn
+// names the builtin in the error message.
+func regexArg(tok token.Token, fn string, v ast.Value) (*regexp.Regexp, error) {
+	if re, ok := v.(*ast.RegexValue); ok {
+		return re.Regexp, nil
+	}
+	re, err := regexp.Compile(stringArg(v))
+	if err != nil {
+		reason := err.Error()
+		if se, ok := err.(*syntax.Error); ok {
+			reason = string(se.Code)
+		}
+		return nil, newError(tok, "%s: invalid regex %s: %s", fn, show(v), reason)
+	}
+	return re, nil
+}
+
+// captures returns the groups of the first match of re in s: an object of
+// the named groups when re names any, or else an array of the groups. Both are
+// empty when re does not match, and groups that did not take part in the match
+// are empty strings.
+func captures(tok token.Token, re *regexp.Regexp, s string) ast.Value {
+	m := re.FindStringSubmatch(s)
+	names := re.SubexpNames()
+
+	named := false
+	for _, name := range names {
+		named = named || name != ""
+	}
+
+	if named {
+		result := &ast.ObjectValue{Token: tok, Attributes: []ast.Attribute{}}
+		for i, name := range names {
+			if name != "" && m != nil {
+				result.Attributes = append(result.Attributes, ast.Attribute{Token: tok, Key: name, V: newString(tok, m[i])})
+			}
+		}
+		return result
+	}
+
+	result := &ast.ArrayValue{Token: tok, Values: []ast.Value{}}
+	if m != nil {
+		for _, group := range m[1:] {
+			result.Values = append(result.Values, newString(tok, group))
+		}
+	}
+	return result
+}
+
+func numberArg(v ast.Value) float64 {
+	return v.(*ast.NumberValue).Value
+}
+
+// lessThan orders two numbers or two strings. ok is false for other values.
+func lessThan(a, b ast.Value) (less bool, ok bool) {
+	switch a := a.(type) {
+	case *ast.NumberValue:
+		if b, ok := b.(*ast.NumberValue); ok {
+			return a.Value < b.Value, true
+		}
+	case *ast.StringValue:
+		if b, ok := b.(*ast.StringValue); ok {
+			return a.Value < b.Value, true
+		}
+	case *ast.DurationValue:
+		if b, ok := b.(*ast.DurationValue); ok {
+			return a.Value < b.Value, true
+		}
+	case *ast.ByteSizeValue:
+		if b, ok := b.(*ast.ByteSizeValue); ok {
+			return a.Value < b.Value, true
+		}
+	case *ast.TimestampValue:
+		if b, ok := b.(*ast.TimestampValue); ok {
+			return a.Value.Before(b.Value), true
+		}
+	}
+	return false, false
+}
+
+func contains(values []ast.Value, v ast.Value) bool {
+	for _, e := range values {
+		if equal(e, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// formatString implements format. It understands the verbs of package fmt,
+// converting each argument to what the verb expects: %d and %x take integral
+// numbers, %e %f and %g numbers, and %s %v and %q any value. The verbs of a
+// secret format are redacted in error messages.
+func formatString(tok token.Token, format *ast.StringValue, args []ast.Value) (ast.Value, error) {
+	var out bytes.Buffer
+	f := format.Value
+	shown := func(verb string) string {
+		if format.Secret {
+			return ast.Redacted
+		}
+		return verb
+	}
+
+	n := 0
+	for i := 0; i < len(f); i++ {
+		if f[i] != '%' {
+			out.WriteByte(f[i])
+			continue
+		}
+
+		start := i
+		i++
+		for i < len(f) && strings.IndexByte("+-# 0123456789.", f[i]) >= 0 {
+			i++
+		}
+		if i == len(f) {
+			return nil, newError(tok, "format: incomplete verb %s", show(newString(tok, shown(f[start:]))))
+		}
+		verb := f[start : i+1]
+		if f[i] == '%' {
+			out.WriteByte('%')
+			continue
+		}
+
+		if n == len(args) {
+			return nil, newError(tok, "format: missing argument for %s", shown(verb))
+		}
+		arg := args[n]
+		n++
+
+		switch f[i] {
+		case 'd', 'x', 'X':
+			num, ok := arg.(*ast.NumberValue)
+			if !ok || num.Value != math.Trunc(num.Value) {
+				return nil, newError(tok, "format: %s needs an integer, got %s", shown(verb), show(arg))
+			}
+			fmt.Fprintf(&out, verb, int64(num.Value))
+		case 'e', 'f', 'g':
+			num, ok := arg.(*ast.NumberValue)
+			if !ok {
+				return nil, newError(tok, "format: %s needs a number, got %s", shown(verb), typeName(arg))
+			}
+			fmt.Fprintf(&out, verb, num.Value)
+		case 's', 'v', 'q':
+			s := arg.String()
+			if sv, ok := arg.(*ast.StringValue); ok {
+				s = sv.Value
+			}
+			fmt.Fprintf(&out, verb, s)
+		default:
+			return nil, newError(tok, "format: unknown verb %s", shown(verb))
+		}
+	}
+
+	if n < len(args) {
+		return nil, newError(tok, "format: %d arguments given, %d used", len(args), n)
+	}
+
+	return newString(tok, out.String()), nil
+}
+
+// lookupEnv returns the environment variable name, or the first of defaults
+// when it is not set.
+func (e *Evaluator) lookupEnv(tok token.Token, name *ast.StringValue, defaults []ast.Value) (ast.Value, error) {
+	if e.environAllow != nil && !e.environAllow[name.Value] {
+		return nil, newError(tok, "environment variable %s is not allowed", showName(name))
+	}
+
+	var v string
+	var ok bool
+	if e.environ != nil {
+		v, ok = e.environ[name.Value]
+	} else {
+		v, ok = os.LookupEnv(name.Value)
+	}
+
+	if ok {
+		return newString(tok, v), nil
+	}
+	if len(defaults) > 0 {
+		return defaults[0], nil
+	}
+	return nil, newError(tok, "environment variable %s is not set", showName(name))
+}
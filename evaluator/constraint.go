@@ -0,0 +1,206 @@
+package evaluator
+
+import (
+	"math"
+
+	"github.com/salleaffaire/ynt/ast"
+	"github.com/salleaffaire/ynt/token"
+)
+
+// typeConstraints are the type names of the builtin scope.
+var typeConstraints = []string{"int", "number", "string", "boolean", "array", "object", "duration", "bytesize", "timestamp", "regex"}
+
+func isConstraint(v ast.Value) bool {
+	switch v.(type) {
+	case *ast.TypeConstraint, *ast.BoundConstraint, *ast.Disjunction, *ast.Conjunction:
+		return true
+	}
+	return false
+}
+
+// concrete returns v when it is not a constraint, or else the value the
+// constraint was unified with or its default. ok is false when there is no
+// such value.
+func concrete(v ast.Value) (ast.Value, bool) {
+	switch c := v.(type) {
+	case *ast.Conjunction:
+		if c.Value != nil {
+			return c.Value, true
+		}
+		for _, cc := range c.Constraints {
+			if d, ok := cc.(*ast.Disjunction); ok && d.Default != nil && satisfies(c, d.Default) {
+				return d.Default, true
+			}
+		}
+		return nil, false
+	case *ast.Disjunction:
+		return c.Default, c.Default != nil
+	case *ast.TypeConstraint, *ast.BoundConstraint:
+		return nil, false
+	}
+	return v, true
+}
+
+// satisfies reports whether the concrete value v satisfies the constraint c.
+// A concrete c is only satisfied by an equal value.
+func satisfies(c ast.Value, v ast.Value) bool {
+	switch c := c.(type) {
+	case *ast.TypeConstraint:
+		if c.Name == "int" {
+			n, ok := v.(*ast.NumberValue)
+			return ok && n.Value == math.Trunc(n.Value)
+		}
+		return typeName(v) == c.Name
+
+	case *ast.BoundConstraint:
+		switch c.Operator {
+		case "!=":
+			return !equal(v, c.Bound)
+		case "<":
+			less, ok := lessThan(v, c.Bound)
+			return ok && less
+		case "<=":
+			less, ok := lessThan(c.Bound, v)
+			return ok && !less
+		case ">":
+			less, ok := lessThan(c.Bound, v)
+			return ok && less
+		case ">=":
+			less, ok := lessThan(v, c.Bound)
+			return ok && !less
+		}
+		return false
+
+	case *ast.Disjunction:
+		for _, a := range c.Alternatives {
+			if satisfies(a, v) {
+				return true
+			}
+		}
+		return false
+
+	case *ast.Conjunction:
+		for _, cc := range c.Constraints {
+			if !satisfies(cc, v) {
+				return false
+			}
+		}
+		return true
+	}
+
+	return equal(c, v)
+}
+
+// toConjunction returns v as a conjunction.
+func toConjunction(v ast.Value) *ast.Conjunction {
+	switch v := v.(type) {
+	case *ast.Conjunction:
+		return v
+	case *ast.TypeConstraint, *ast.BoundConstraint, *ast.Disjunction:
+		return &ast.Conjunction{Constraints: []ast.Value{v}}
+	}
+	return &ast.Conjunction{Value: v}
+}
+
+// unify implements the & operator. It returns the conjunction of a and b, or
+// their common value when both are concrete.
+func unify(tok token.Token, a, b ast.Value) (ast.Value, error) {
+	if !isConstraint(a) && !isConstraint(b) {
+		if !equal(a, b) {
+			return nil, newError(tok, "conflicting values %s and %s", show(a), show(b))
+		}
+		return a, nil
+	}
+
+	ca, cb := toConjunction(a), toConjunction(b)
+	result := &ast.Conjunction{
+		Token:       tok,
+		Constraints: append(append([]ast.Value{}, ca.Constraints...), cb.Constraints...),
+		Value:       ca.Value,
+	}
+
+	if cb.Value != nil {
+		if result.Value != nil && !equal(result.Value, cb.Value) {
+			return nil, newError(tok, "conflicting values %s and %s", show(result.Value), show(cb.Value))
+		}
+		result.Value = cb.Value
+	}
+
+	if result.Value != nil {
+		for _, c := range result.Constraints {
+			if !satisfies(c, result.Value) {
+				return nil, newError(tok, "invalid value %s: does not satisfy %s", show(result.Value), show(c))
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// evalDisjunction evaluates a | b, flattening nested disjunctions and keeping
+// track of the alternative marked as the default.
+func (e *Evaluator) evalDisjunction(ie *ast.InfixExpression, env *Environment) (ast.Value, error) {
+	result := &ast.Disjunction{Token: ie.Token}
+
+	for _, operand := range []ast.Value{ie.Left, ie.Right} {
+		isDefault := false
+		if de, ok := operand.(*ast.DefaultExpression); ok {
+			operand = de.Value
+			isDefault = true
+		}
+
+		v, err := e.Eval(operand, env)
+		if err != nil {
+			return nil, err
+		}
+
+		alternatives := []ast.Value{v}
+		var def ast.Value
+		if d, ok := v.(*ast.Disjunction); ok && !isDefault {
+			alternatives = d.Alternatives
+			def = d.Default
+		} else if isDefault {
+			def = v
+		}
+
+		if def != nil {
+			if result.Default != nil {
+				return nil, newError(ie.Token, "more than one default in %s", ie.String())
+			}
+			result.Default = def
+		}
+		result.Alternatives = append(result.Alternatives, alternatives...)
+	}
+
+	return result, nil
+}
+
+func (e *Evaluator) evalBoundExpression(be *ast.BoundExpression, env *Environment) (ast.Value, error) {
+	bound, err := e.Eval(be.Value, env)
+	if err != nil {
+		return nil, err
+	}
+
+	switch bound.(type) {
+	case *ast.NumberValue, *ast.StringValue, *ast.DurationValue, *ast.ByteSizeValue, *ast.TimestampValue:
+	default:
+		if be.Operator != "!=" {
+			return nil, newError(be.Token, "bound %s must be a number, a string, a duration, a byte size or a timestamp, got %s", be.Operator, typeName(bound))
+		}
+	}
+
+	return &ast.BoundConstraint{Token: be.Token, Operator: be.Operator, Bound: bound}, nil
+}
+
+// combineConstraints returns the conjunction of the constraints a and b, either
+// of which can be nil.
+func combineConstraints(a, b ast.Value) ast.Value {
+	if a == nil {
+		return b
+	}
+	if b == nil || a == b {
+		return a
+	}
+	constraints := append(append([]ast.Value{}, toConjunction(a).Constraints...), toConjunction(b).Constraints...)
+	return &ast.Conjunction{Constraints: constraints}
+}
@@ -0,0 +1,123 @@
+package evaluator
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/salleaffaire/ynt/ast"
+	"github.com/salleaffaire/ynt/token"
+)
+
+// uuidNamespaces are the namespaces of RFC 4122 that uuidv5 knows by name.
+var uuidNamespaces = map[string]string{
+	"dns":  "6ba7b810-9dad-11d1-80b4-00c04fd430c8",
+	"url":  "6ba7b811-9dad-11d1-80b4-00c04fd430c8",
+	"oid":  "6ba7b812-9dad-11d1-80b4-00c04fd430c8",
+	"x500": "6ba7b814-9dad-11d1-80b4-00c04fd430c8",
+}
+
+// hashable returns the bytes of v that are hashed: those of a string, or else
+// the canonical JSON form of v.
+func hashable(v ast.Value) ([]byte, error) {
+	if s, ok := v.(*ast.StringValue); ok {
+		return []byte(s.Value), nil
+	}
+	return canonicalJSON(v)
+}
+
+// canonicalJSON returns v as it is output, in a form that does not depend on
+// how it was written: without white space, with the fields of objects sorted by
+// key and numbers in their shortest form. Durations, byte sizes and timestamps
+// are encoded as they are by default, whatever the options of the evaluator.
+func canonicalJSON(v ast.Value) ([]byte, error) {
+	mv, err := (&Evaluator{}).manifest(v)
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	writeCanonical(&out, mv)
+	return out.Bytes(), nil
+}
+
+func writeCanonical(out *bytes.Buffer, v ast.Value) {
+	switch v := v.(type) {
+	case *ast.ObjectValue:
+		atts := append([]ast.Attribute{}, v.Attributes...)
+		sort.Slice(atts, func(i, j int) bool { return atts[i].Key < atts[j].Key })
+		out.WriteByte('{')
+		for i, att := range atts {
+			if i > 0 {
+				out.WriteByte(',')
+			}
+			fmt.Fprintf(out, `"%s":`, ast.Escape(att.Key))
+			writeCanonical(out, att.V)
+		}
+		out.WriteByte('}')
+	case *ast.ArrayValue:
+		out.WriteByte('[')
+		for i, elem := range v.Values {
+			if i > 0 {
+				out.WriteByte(',')
+			}
+			writeCanonical(out, elem)
+		}
+		out.WriteByte(']')
+	case *ast.StringValue:
+		fmt.Fprintf(out, `"%s"`, ast.Escape(v.Value))
+	case *ast.NumberValue:
+		out.WriteString(newNumber(v.Token, v.Value).Token.Literal)
+	default:
+		out.WriteString(v.String())
+	}
+}
+
+// decodedString returns the string of the decoded bytes b, which must be
+// UTF-8 to be output. fn names the builtin in the error message.
+func decodedString(tok token.Token, fn string, b []byte) (ast.Value, error) {
+	if !utf8.Valid(b) {
+		return nil, newError(tok, "%s: decoded bytes are not UTF-8 text", fn)
+	}
+	return newString(tok, string(b)), nil
+}
+
+// hashBuiltin returns a builtin hashing its argument with h, in hexadecimal.
+func hashBuiltin(h func() hash.Hash) func(*Evaluator, token.Token, []ast.Value) (ast.Value, error) {
+	return func(e *Evaluator, tok token.Token, args []ast.Value) (ast.Value, error) {
+		b, err := hashable(args[0])
+		if err != nil {
+			return nil, err
+		}
+		sum := h()
+		sum.Write(b)
+		return newString(tok, hex.EncodeToString(sum.Sum(nil))), nil
+	}
+}
+
+// uuidv5 returns the name-based UUID of version 5 of RFC 4122 for name in
+// ns, a UUID or one of the names of uuidNamespaces.
+func uuidv5(tok token.Token, ns *ast.StringValue, name []byte) (ast.Value, error) {
+	namespace := ns.Value
+	if uuid, ok := uuidNamespaces[namespace]; ok {
+		namespace = uuid
+	}
+	b, err := hex.DecodeString(strings.ReplaceAll(namespace, "-", ""))
+	if err != nil || len(b) != 16 || len(namespace) != 36 {
+		return nil, newError(tok, "uuidv5: invalid namespace %s", show(ns))
+	}
+
+	h := sha1.New()
+	h.Write(b)
+	h.Write(name)
+	u := h.Sum(nil)[:16]
+	u[6] = u[6]&0x0f | 0x50
+	u[8] = u[8]&0x3f | 0x80
+
+	s := hex.EncodeToString(u)
+	return newString(tok, s[:8]+"-"+s[8:12]+"-"+s[12:16]+"-"+s[16:20]+"-"+s[20:]), nil
+}
@@ -0,0 +1,99 @@
+package evaluator
+
+import (
+	"github.com/salleaffaire/ynt/ast"
+)
+
+// thunk is a binding whose value is computed the first time it is needed, so
+// that the fields of an object can refer to each other in any order.
+type thunk struct {
+	node ast.Value
+	env  *Environment
+
+	// then, when set, transforms the value once it is evaluated
+	then func(ast.Value) (ast.Value, error)
+
+	value      ast.Value
+	evaluating bool
+}
+
+type Environment struct {
+	store map[string]*thunk
+	outer *Environment
+
+	// skip is looked up past outer. A field's value is evaluated in such an
+	// environment so that {name: name} refers to the enclosing name rather
+	// than to itself.
+	skip string
+
+	// call is set on the environment of a function call. Lookups from inside
+	// a function body ignore skip, so that functions can be recursive.
+	call bool
+
+	// file is the name of the file whose code is evaluated in the environment,
+	// or "" when it does not come from a file.
+	file string
+
+	// object is set on the scope of an object literal that refers to self or
+	// super, whose index in the layers of object is layer.
+	object *object
+	layer  int
+}
+
+func NewEnvironment() *Environment {
+	s := make(map[string]*thunk)
+	return &Environment{store: s, outer: nil}
+}
+
+func NewEnclosedEnvironment(outer *Environment) *Environment {
+	env := NewEnvironment()
+	env.outer = outer
+	env.file = outer.file
+	return env
+}
+
+func (e *Environment) get(name string) (*thunk, bool) {
+	return e.lookup(name, true)
+}
+
+func (e *Environment) lookup(name string, skip bool) (*thunk, bool) {
+	th, ok := e.store[name]
+	if ok {
+		return th, ok
+	}
+
+	skip = skip && !e.call
+	outer := e.outer
+	if skip && name == e.skip && outer != nil {
+		outer = outer.outer
+	}
+	if outer != nil {
+		return outer.lookup(name, skip)
+	}
+	return nil, false
+}
+
+// Set binds name to an already evaluated value.
+func (e *Environment) Set(name string, val ast.Value) ast.Value {
+	e.store[name] = &thunk{value: val}
+	return val
+}
+
+func newCallEnvironment(outer *Environment) *Environment {
+	env := NewEnclosedEnvironment(outer)
+	env.call = true
+	return env
+}
+
+// newFieldEnvironment returns the environment the value of the field key of
+// the object scope is evaluated in.
+func newFieldEnvironment(scope *Environment, key string) *Environment {
+	env := NewEnclosedEnvironment(scope)
+	env.skip = key
+	return env
+}
+
+// setLazy binds name to node, to be evaluated in env on first use.
+func (e *Environment) setLazy(name string, node ast.Value, env *Environment) {
+	e.store[name] = &thunk{node: node, env: env}
+}
@@ -0,0 +1,1620 @@
+package evaluator
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/salleaffaire/ynt/ast"
+	"github.com/salleaffaire/ynt/token"
+)
+
+// DefaultMaxDepth is the number of nested function calls after which
+// evaluation fails, which stops runaway recursion.
+const DefaultMaxDepth = 1000
+
+// maxTraceFrames is the number of frames of a trace shown at each end by
+// Error.
+const maxTraceFrames = 10
+
+// Error is an evaluation error, located at the token that caused it in File.
+// Trace lists the function calls it went through, innermost first. Err is the
+// error that caused it, if any, such as a StepLimitError or the error of a
+// canceled context.
+type Error struct {
+	File    string
+	Token   token.Token
+	Message string
+	Trace   []Frame
+	Err     error
+
+	// located is set once File is known
+	located bool
+}
+
+// Frame is a function call in the trace of an Error.
+type Frame struct {
+	Name  string
+	File  string
+	Token token.Token
+}
+
+func position(file string, tok token.Token) string {
+	if file == "" {
+		return fmt.Sprintf("line %d column %d", tok.Line, tok.Column)
+	}
+	return fmt.Sprintf("%s line %d column %d", file, tok.Line, tok.Column)
+}
+
+func (e *Error) Error() string {
+	var out bytes.Buffer
+
+	fmt.Fprintf(&out, "Error: %s - %s", e.Message, position(e.File, e.Token))
+	for i, f := range e.Trace {
+		if len(e.Trace) > 2*maxTraceFrames && i == maxTraceFrames {
+			fmt.Fprintf(&out, "\n\t... %d more calls", len(e.Trace)-2*maxTraceFrames)
+		}
+		if len(e.Trace) > 2*maxTraceFrames && i >= maxTraceFrames && i < len(e.Trace)-maxTraceFrames {
+			continue
+		}
+		fmt.Fprintf(&out, "\n\tat %s - %s", f.Name, position(f.File, f.Token))
+	}
+
+	return out.String()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func newError(tok token.Token, format string, a ...interface{}) *Error {
+	return &Error{Token: tok, Message: fmt.Sprintf(format, a...)}
+}
+
+// wrapError returns an Error at tok caused by err.
+func wrapError(tok token.Token, err error) *Error {
+	return &Error{Token: tok, Message: err.Error(), Err: err}
+}
+
+// fileName returns how the file or the directory name of the evaluator file
+// system is shown.
+func (e *Evaluator) fileName(name string) string {
+	if e.fileNames == nil {
+		return name
+	}
+	return e.fileNames(strings.TrimPrefix(name, "/"))
+}
+
+// showFiles returns err with the files of its position and of its trace shown
+// as fileName does.
+func (e *Evaluator) showFiles(err error) error {
+	var ee *Error
+	if e.fileNames == nil || !errors.As(err, &ee) {
+		return err
+	}
+	if ee.File != "" {
+		ee.File = e.fileName(ee.File)
+	}
+	for i, f := range ee.Trace {
+		if f.File != "" {
+			ee.Trace[i].File = e.fileName(f.File)
+		}
+	}
+	return err
+}
+
+// causeError is an error made of a message and of the error causing it.
+type causeError struct {
+	message string
+	err     error
+}
+
+func (e *causeError) Error() string {
+	return e.message
+}
+
+func (e *causeError) Unwrap() error {
+	return e.err
+}
+
+// wrapCause returns an error caused by err, whose message is format followed by
+// the one of err, without the Error: prefix of those of the lexer and the
+// parser.
+func wrapCause(err error, format string, a ...interface{}) error {
+	message := fmt.Sprintf(format, a...) + ": " + strings.TrimPrefix(err.Error(), "Error: ")
+	return &causeError{message: message, err: err}
+}
+
+// Function is a function literal closed over the environment it was
+// evaluated in.
+type Function struct {
+	*ast.FunctionLiteral
+	Env *Environment
+}
+
+type Evaluator struct {
+	ctx context.Context
+
+	depth    int
+	maxDepth int
+
+	steps     int
+	maxSteps  int
+	maxOutput int
+	// outputSize is the number of bytes of the result output so far.
+	outputSize int
+
+	fsys       fs.FS
+	searchPath []string
+	// fileNames returns how the files of fsys are shown, when set
+	fileNames func(string) string
+
+	// External arguments, and the environment binding them during an
+	// evaluation
+	externals map[string]external
+	extEnv    *Environment
+
+	// Profiles selected, those declared by the evaluated files, and the
+	// profile that set each output field
+	profiles         []string
+	declaredProfiles map[string]bool
+	profileSources   map[string]string
+
+	// Whether provenance is recorded, the provenance of the fields of each
+	// object and of each value given to a field, and the result of the last
+	// evaluation before it is output
+	provenance  bool
+	chains      map[*ast.ObjectValue]map[string][]Step
+	valueChains map[ast.Value][]Step
+	result      ast.Value
+
+	// Whether merging conflicting concrete values is an error
+	strict bool
+
+	// The layers of the objects evaluated from object literals that refer to
+	// self or super
+	layers map[*ast.ObjectValue][]layer
+
+	// The assertions of the objects evaluated from object literals that have
+	// some, checked again when they are merged
+	checks map[*ast.ObjectValue][]check
+
+	// How durations, byte sizes and timestamps are output
+	durationUnit    string
+	byteSizeUnit    string
+	timestampFormat string
+
+	// Provider of the secrets read by secret()
+	secrets SecretProvider
+
+	// Environment variables read by env(), from the process when nil, and the
+	// names it may read, all of them when nil
+	environ      map[string]string
+	environAllow map[string]bool
+
+	// Files imported during the current evaluation, and the chain of those
+	// being evaluated
+	imports   map[string]ast.Value
+	importing []string
+}
+
+// Option configures an Evaluator.
+type Option func(*Evaluator)
+
+// WithFS makes the evaluator load files, including imports, from fsys.
+// Without it, imports fail.
+func WithFS(fsys fs.FS) Option {
+	return func(e *Evaluator) {
+		e.fsys = fsys
+	}
+}
+
+// WithSearchPath adds directories of the file system where imports are looked
+// for when they are not found relative to the importing file.
+func WithSearchPath(dirs ...string) Option {
+	return func(e *Evaluator) {
+		e.searchPath = append(e.searchPath, dirs...)
+	}
+}
+
+// WithFileNames makes errors and provenance show the file of the evaluator file
+// system named name, or the directory, as names returns it, such as a path of
+// the operating system.
+func WithFileNames(names func(name string) string) Option {
+	return func(e *Evaluator) {
+		e.fileNames = names
+	}
+}
+
+// WithEnv makes env() read vars instead of the process environment.
+func WithEnv(vars map[string]string) Option {
+	return func(e *Evaluator) {
+		e.environ = vars
+	}
+}
+
+// WithEnvAllowlist restricts env() to the variables named, so that a document
+// cannot read anything else from the environment. With no names, env() cannot
+// read any variable.
+func WithEnvAllowlist(names ...string) Option {
+	return func(e *Evaluator) {
+		if e.environAllow == nil {
+			e.environAllow = make(map[string]bool)
+		}
+		for _, name := range names {
+			e.environAllow[name] = true
+		}
+	}
+}
+
+func New(options ...Option) *Evaluator {
+	e := &Evaluator{maxDepth: DefaultMaxDepth}
+	for _, option := range options {
+		option(e)
+	}
+	return e
+}
+
+// EvalDocument evaluates every value of the document and returns the last one,
+// as it is output: without hidden fields, and with every constraint resolved to
+// a value.
+func (e *Evaluator) EvalDocument(document *ast.Document) (ast.Value, error) {
+	return e.EvalDocumentContext(context.Background(), document)
+}
+
+// EvalDocumentContext is like EvalDocument but stops when ctx is done, with an
+// error wrapping the one of ctx.
+func (e *Evaluator) EvalDocumentContext(ctx context.Context, document *ast.Document) (ast.Value, error) {
+	result, err := e.evalEntry(ctx, document)
+	if err != nil {
+		return nil, e.showFiles(err)
+	}
+	return result, nil
+}
+
+func (e *Evaluator) evalEntry(ctx context.Context, document *ast.Document) (ast.Value, error) {
+	if err := e.reset(ctx); err != nil {
+		return nil, err
+	}
+
+	v, err := e.evalDocument(document, "", false)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.checkProfiles(); err != nil {
+		return nil, err
+	}
+	e.result = v
+
+	return e.output(v)
+}
+
+// EvalFile parses and evaluates the file name of the evaluator file system.
+func (e *Evaluator) EvalFile(name string) (ast.Value, error) {
+	return e.EvalFileContext(context.Background(), name)
+}
+
+// EvalFileContext is like EvalFile but stops when ctx is done, with an error
+// wrapping the one of ctx.
+func (e *Evaluator) EvalFileContext(ctx context.Context, name string) (ast.Value, error) {
+	result, err := e.evalFile(ctx, name)
+	if err != nil {
+		return nil, e.showFiles(err)
+	}
+	return result, nil
+}
+
+func (e *Evaluator) evalFile(ctx context.Context, name string) (ast.Value, error) {
+	if err := e.reset(ctx); err != nil {
+		return nil, err
+	}
+
+	document, err := e.loadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("Error: %w", err)
+	}
+
+	e.importing = []string{name}
+	v, err := e.evalDocument(document, name, false)
+	if err != nil {
+		return nil, err
+	}
+	e.imports[name] = v
+	if err := e.checkProfiles(); err != nil {
+		return nil, err
+	}
+	e.result = v
+
+	result, err := e.output(v)
+	if err != nil {
+		var ee *Error
+		if errors.As(err, &ee) {
+			ee.File = name
+		}
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// reset forgets the state of the previous evaluation and starts one bound to
+// ctx, with the external arguments evaluated.
+func (e *Evaluator) reset(ctx context.Context) error {
+	e.ctx = ctx
+	e.depth = 0
+	e.steps = 0
+	e.imports = make(map[string]ast.Value)
+	e.importing = nil
+	e.declaredProfiles = make(map[string]bool)
+	e.profileSources = make(map[string]string)
+	e.chains = make(map[*ast.ObjectValue]map[string][]Step)
+	e.valueChains = make(map[ast.Value][]Step)
+	e.layers = make(map[*ast.ObjectValue][]layer)
+	e.checks = make(map[*ast.ObjectValue][]check)
+	e.result = nil
+
+	if err := e.checkUnits(); err != nil {
+		return err
+	}
+	env, err := e.externalEnv()
+	if err != nil {
+		return err
+	}
+	e.extEnv = env
+
+	return nil
+}
+
+// evalDocument evaluates document, read from file. imported is true when
+// another file imports it, which only sees the fields it exports.
+func (e *Evaluator) evalDocument(document *ast.Document, file string, imported bool) (ast.Value, error) {
+	env := NewEnclosedEnvironment(e.extEnv)
+	env.file = file
+
+	if err := e.bindParams(document.Params, env); err != nil {
+		return nil, locate(err, env)
+	}
+	if err := e.bindImports(document.Imports, env); err != nil {
+		return nil, locate(err, env)
+	}
+
+	var result ast.Value
+	for _, v := range document.Values {
+		var err error
+		result, err = e.Eval(v, env)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(document.Profiles) > 0 {
+		var err error
+		result, err = e.applyProfiles(document.Profiles, result, env, imported)
+		if err != nil {
+			return nil, locate(err, env)
+		}
+	}
+
+	// Top level assertions see the fields of the result
+	if len(document.Assertions) > 0 {
+		scope := NewEnclosedEnvironment(env)
+		if ov, ok := result.(*ast.ObjectValue); ok {
+			for _, att := range ov.Attributes {
+				scope.Set(att.Key, att.V)
+			}
+		}
+		for _, a := range document.Assertions {
+			if err := e.checkAssertion(a, scope); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Exports only hide fields from the files importing this one
+	if imported {
+		var err error
+		if result, err = export(document.Exports, result); err != nil {
+			return nil, locate(err, env)
+		}
+	}
+
+	return result, nil
+}
+
+// Eval reduces node to a value made only of numbers, strings, booleans,
+// arrays, objects and functions.
+func (e *Evaluator) Eval(node ast.Value, env *Environment) (ast.Value, error) {
+	v, err := e.eval(node, env)
+	return v, locate(err, env)
+}
+
+// locate sets the file of err, unless it is already known, to the one of env.
+func locate(err error, env *Environment) error {
+	if ee, ok := err.(*Error); ok && !ee.located {
+		ee.File = env.file
+		ee.located = true
+	}
+	return err
+}
+
+func (e *Evaluator) eval(node ast.Value, env *Environment) (ast.Value, error) {
+	switch node := node.(type) {
+
+	case *ast.NumberValue, *ast.StringValue, *ast.BooleanValue, *ast.NullValue, *ast.RegexValue,
+		*ast.DurationValue, *ast.ByteSizeValue, *ast.TimestampValue:
+		return node, nil
+
+	case *ast.ArrayValue:
+		return e.evalArrayValue(node, env)
+
+	case *ast.ObjectValue:
+		return e.evalObjectValue(node, env)
+
+	case *ast.Identifier:
+		return e.evalIdentifier(node, env)
+
+	case *ast.PrefixExpression:
+		right, err := e.Eval(node.Right, env)
+		if err != nil {
+			return nil, err
+		}
+		return evalPrefixExpression(node, right)
+
+	case *ast.InfixExpression:
+		return e.evalInfixExpression(node, env)
+
+	case *ast.MemberExpression:
+		return e.evalMemberExpression(node, env)
+
+	case *ast.IndexExpression:
+		return e.evalIndexExpression(node, env)
+
+	case *ast.SliceExpression:
+		return e.evalSliceExpression(node, env)
+
+	case *ast.ArrayComprehension:
+		return e.evalArrayComprehension(node, env)
+
+	case *ast.ObjectComprehension:
+		return e.evalObjectComprehension(node, env)
+
+	case *ast.TryExpression:
+		return e.evalTryExpression(node, env)
+
+	case *ast.IfExpression:
+		return e.evalIfExpression(node, env)
+
+	case *ast.FunctionLiteral:
+		return &Function{FunctionLiteral: node, Env: env}, nil
+
+	case *ast.CallExpression:
+		return e.evalCallExpression(node, env)
+
+	case *ast.ImportExpression:
+		return e.evalImportExpression(node, env)
+
+	case *ast.BoundExpression:
+		return e.evalBoundExpression(node, env)
+
+	case *ast.DefaultExpression:
+		return nil, newError(node.Token, "default %s outside of a disjunction", node.String())
+
+	case *ast.SelfExpression, *ast.SuperExpression:
+		return nil, newError(lateToken(node), "%s must be followed by a field, as in %s.name", node.String(), node.String())
+
+	case *Function, *Builtin, *ast.TypeConstraint, *ast.BoundConstraint, *ast.Disjunction, *ast.Conjunction:
+		return node, nil
+	}
+
+	return nil, fmt.Errorf("Error: cannot evaluate %T", node)
+}
+
+func (e *Evaluator) evalArrayValue(av *ast.ArrayValue, env *Environment) (ast.Value, error) {
+	result := &ast.ArrayValue{Token: av.Token, Values: make([]ast.Value, 0, len(av.Values))}
+
+	for _, v := range av.Values {
+		if se, ok := v.(*ast.SpreadElement); ok {
+			spread, err := e.Eval(se.Value, env)
+			if err != nil {
+				return nil, err
+			}
+			elements, ok := spread.(*ast.ArrayValue)
+			if !ok {
+				return nil, newError(se.Token, "cannot spread %s into an array", typeName(spread))
+			}
+			result.Values = append(result.Values, elements.Values...)
+			continue
+		}
+
+		evaluated, err := e.Eval(v, env)
+		if err != nil {
+			return nil, err
+		}
+		if c, ok := concrete(evaluated); ok {
+			evaluated = c
+		}
+		result.Values = append(result.Values, evaluated)
+	}
+
+	return result, nil
+}
+
+// evalObjectValue evaluates the attributes of ov in a scope where each of them
+// is visible by its key. Spreads and the attributes that follow them are deep
+// merged in order.
+func (e *Evaluator) evalObjectValue(ov *ast.ObjectValue, env *Environment) (ast.Value, error) {
+	if ov.Late {
+		return e.instantiate(Step{Kind: StepMerge, File: env.file, Token: ov.Token}, []layer{{lit: ov, env: env}})
+	}
+
+	scope := NewEnclosedEnvironment(env)
+	ov, err := e.bindObject(ov, scope)
+	if err != nil {
+		return nil, err
+	}
+	return e.evalFields(ov, scope)
+}
+
+// bindObject binds the fields and the patterns of the object literal ov in
+// scope, and returns ov with its computed keys evaluated.
+func (e *Evaluator) bindObject(ov *ast.ObjectValue, scope *Environment) (*ast.ObjectValue, error) {
+	for _, att := range ov.Attributes {
+		if att.Spread || att.Computed != nil {
+			continue
+		}
+		if err := bindField(scope, att); err != nil {
+			return nil, err
+		}
+	}
+	ov, err := e.computeKeys(ov, scope)
+	if err != nil {
+		return nil, err
+	}
+	if len(ov.Patterns) > 0 {
+		if err := e.bindPatterns(ov, scope); err != nil {
+			return nil, err
+		}
+	}
+	return ov, nil
+}
+
+// evalFields evaluates the object literal ov, whose fields are bound in scope.
+func (e *Evaluator) evalFields(ov *ast.ObjectValue, scope *Environment) (*ast.ObjectValue, error) {
+	result := &ast.ObjectValue{Token: ov.Token, Attributes: make([]ast.Attribute, 0, len(ov.Attributes))}
+	for _, att := range ov.Attributes {
+		if att.Spread {
+			v, err := e.Eval(att.V, scope)
+			if err != nil {
+				return nil, err
+			}
+			spread, ok := v.(*ast.ObjectValue)
+			if !ok {
+				return nil, newError(att.Token, "cannot spread %s into an object", typeName(v))
+			}
+			step := Step{Kind: StepSpread, File: scope.file, Token: att.Token}
+			for _, sa := range spread.Attributes {
+				chain := append([]Step{step}, e.chains[spread][sa.Key]...)
+				if err := e.mergeAttribute(step, result, sa, chain); err != nil {
+					return nil, err
+				}
+			}
+			continue
+		}
+
+		v, err := e.force(scope.store[att.Key], att.Token)
+		if err != nil {
+			var ok bool
+			if v, ok = incomplete(scope, err); !ok {
+				return nil, err
+			}
+		}
+		evaluated := evaluatedAttribute(att, v)
+		var chain []Step
+		if e.provenance {
+			chain = e.fieldChain(scope.file, att, evaluated.V)
+		}
+		step := Step{Kind: StepField, Name: att.Key, File: scope.file, Token: att.Token}
+		if err := e.mergeAttribute(step, result, evaluated, chain); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, a := range ov.Assertions {
+		if err := e.checkAssertion(a, scope); err != nil {
+			return nil, err
+		}
+		if e.checks == nil {
+			e.checks = make(map[*ast.ObjectValue][]check)
+		}
+		e.checks[result] = append(e.checks[result], check{assertion: a, env: scope})
+	}
+
+	return result, nil
+}
+
+// evaluatedAttribute returns the field att of an object literal with its value
+// v, concrete when possible.
+func evaluatedAttribute(att ast.Attribute, v ast.Value) ast.Attribute {
+	evaluated := ast.Attribute{Token: att.Token, Key: att.Key, V: v, Merge: att.Merge, Hidden: att.Hidden}
+	if isConstraint(v) {
+		evaluated.Constraint = v
+		if c, ok := concrete(v); ok {
+			evaluated.V = c
+		}
+	}
+	return evaluated
+}
+
+// bindField binds the field att of an object literal in scope, to be evaluated
+// on first use.
+func bindField(scope *Environment, att ast.Attribute) error {
+	if _, ok := scope.store[att.Key]; ok {
+		return newError(att.Token, "duplicate key %q", att.Key)
+	}
+	scope.setLazy(att.Key, att.V, newFieldEnvironment(scope, att.Key))
+	return nil
+}
+
+// computeKeys returns the object literal ov with the computed keys of its
+// attributes evaluated in scope, where the other fields are bound, and binds
+// the fields they name. An attribute whose key is null is left out, and one
+// whose key is a constraint is a pattern.
+func (e *Evaluator) computeKeys(ov *ast.ObjectValue, scope *Environment) (*ast.ObjectValue, error) {
+	computed := false
+	for _, att := range ov.Attributes {
+		computed = computed || att.Computed != nil
+	}
+	if !computed {
+		return ov, nil
+	}
+
+	result := &ast.ObjectValue{Token: ov.Token, Assertions: ov.Assertions, Patterns: ov.Patterns}
+	for _, att := range ov.Attributes {
+		if att.Computed == nil {
+			result.Attributes = append(result.Attributes, att)
+			continue
+		}
+
+		key, err := e.Eval(att.Computed, scope)
+		if err != nil {
+			return nil, err
+		}
+		switch k := key.(type) {
+		case *ast.StringValue:
+			if k.Secret {
+				return nil, newError(att.Token, "object key cannot be a secret")
+			}
+			att.Key = k.Value
+			att.Computed = nil
+			if err := bindField(scope, att); err != nil {
+				return nil, err
+			}
+			result.Attributes = append(result.Attributes, att)
+		case *ast.NullValue:
+		default:
+			if !isConstraint(key) {
+				return nil, newError(att.Token, "object key must be a string, got %s", typeName(key))
+			}
+			if att.Hidden || att.Merge != ast.MergeDeep {
+				return nil, newError(att.Token, "pattern [%s] cannot be hidden or have a merge marker", show(key))
+			}
+			result.Patterns = append(result.Patterns, &ast.Pattern{Token: att.Token, Constraint: key, Value: att.V})
+		}
+	}
+
+	// Patterns apply in the order they are written
+	sort.SliceStable(result.Patterns, func(i, j int) bool {
+		a, b := result.Patterns[i].Token, result.Patterns[j].Token
+		return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+	})
+
+	return result, nil
+}
+
+// check is an assertion of an object literal, with the scope of the literal.
+type check struct {
+	assertion *ast.Assertion
+	env       *Environment
+}
+
+// recheck checks the assertions of left and right again, with their fields
+// bound to those of merged, the merge of right into left, which keeps them.
+// The objects merged into the fields of merged are checked in turn.
+func (e *Evaluator) recheck(left, right, merged *ast.ObjectValue) error {
+	checks := append(append([]check{}, e.checks[left]...), e.checks[right]...)
+	if len(checks) > 0 {
+		e.checks[merged] = checks
+	}
+	for _, c := range checks {
+		scope := NewEnclosedEnvironment(c.env)
+		for _, att := range merged.Attributes {
+			scope.Set(att.Key, att.V)
+		}
+		if err := e.checkAssertion(c.assertion, scope); err != nil {
+			return err
+		}
+	}
+
+	for _, att := range merged.Attributes {
+		m, ok := att.V.(*ast.ObjectValue)
+		if !ok {
+			continue
+		}
+		l, r := objectField(left, att.Key), objectField(right, att.Key)
+		if l == nil || r == nil || m == l || m == r {
+			continue
+		}
+		if err := e.recheck(l, r, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// objectField returns the value of the field key of ov when it is an object.
+func objectField(ov *ast.ObjectValue, key string) *ast.ObjectValue {
+	if i := attributeIndex(ov, key); i >= 0 {
+		if v, ok := ov.Attributes[i].V.(*ast.ObjectValue); ok {
+			return v
+		}
+	}
+	return nil
+}
+
+// checkAssertion fails with the message of a when its condition is false.
+func (e *Evaluator) checkAssertion(a *ast.Assertion, env *Environment) error {
+	return locate(e.assert(a, env), env)
+}
+
+func (e *Evaluator) assert(a *ast.Assertion, env *Environment) error {
+	cond, err := e.Eval(a.Condition, env)
+	if err != nil {
+		return err
+	}
+	b, ok := cond.(*ast.BooleanValue)
+	if !ok {
+		return newError(a.Token, "assertion condition must be a boolean, got %s", typeName(cond))
+	}
+	if b.Value {
+		return nil
+	}
+
+	if a.Message == nil {
+		return newError(a.Token, "assertion failed: %s", a.Condition.String())
+	}
+	msg, err := e.Eval(a.Message, env)
+	if err != nil {
+		return err
+	}
+	if s, ok := ast.Redact(msg).(*ast.StringValue); ok {
+		return newError(a.Token, "assertion failed: %s", s.Value)
+	}
+	return newError(a.Token, "assertion failed: %s", show(msg))
+}
+
+func (e *Evaluator) evalIdentifier(ident *ast.Identifier, env *Environment) (ast.Value, error) {
+	th, ok := env.get(ident.Value)
+	if !ok {
+		return nil, newError(ident.Token, "identifier not found: %s", ident.Value)
+	}
+
+	v, err := e.force(th, ident.Token)
+	if err != nil {
+		return nil, err
+	}
+	if c, ok := concrete(v); ok {
+		return c, nil
+	}
+	return v, nil
+}
+
+// force returns the value of th, evaluating it if needed. tok is the reference
+// that required it and is used to report cycles.
+func (e *Evaluator) force(th *thunk, tok token.Token) (ast.Value, error) {
+	if th.value != nil {
+		return th.value, nil
+	}
+	if th.evaluating {
+		return nil, newError(tok, "cycle in reference to %s", tok.Literal)
+	}
+
+	th.evaluating = true
+	v, err := e.Eval(th.node, th.env)
+	if err == nil && th.then != nil {
+		v, err = th.then(v)
+	}
+	th.evaluating = false
+	if err != nil {
+		return nil, err
+	}
+
+	th.value = v
+	return v, nil
+}
+
+func evalPrefixExpression(pe *ast.PrefixExpression, right ast.Value) (ast.Value, error) {
+	switch pe.Operator {
+	case "!":
+		b, ok := right.(*ast.BooleanValue)
+		if !ok {
+			return nil, newError(pe.Token, "unknown operator: !%s", typeName(right))
+		}
+		return newBoolean(pe.Token, !b.Value), nil
+	case "-":
+		switch r := right.(type) {
+		case *ast.NumberValue:
+			return newNumber(pe.Token, -r.Value), nil
+		case *ast.DurationValue:
+			return newDuration(pe.Token, -r.Value), nil
+		case *ast.ByteSizeValue:
+			return newByteSize(pe.Token, -r.Value), nil
+		}
+		return nil, newError(pe.Token, "unknown operator: -%s", typeName(right))
+	}
+	return nil, newError(pe.Token, "unknown operator: %s%s", pe.Operator, typeName(right))
+}
+
+func (e *Evaluator) evalInfixExpression(ie *ast.InfixExpression, env *Environment) (ast.Value, error) {
+	if ie.Operator == "|" {
+		return e.evalDisjunction(ie, env)
+	}
+	if ie.Operator == "??" {
+		return e.evalCoalesce(ie, env)
+	}
+
+	left, err := e.Eval(ie.Left, env)
+	if err != nil {
+		return nil, err
+	}
+
+	// && and || only evaluate their right operand when needed
+	if ie.Operator == "&&" || ie.Operator == "||" {
+		l, ok := left.(*ast.BooleanValue)
+		if !ok {
+			return nil, newError(ie.Token, "unknown operator: %s %s", typeName(left), ie.Operator)
+		}
+		if l.Value == (ie.Operator == "||") {
+			return l, nil
+		}
+		right, err := e.Eval(ie.Right, env)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := right.(*ast.BooleanValue); !ok {
+			return nil, newError(ie.Token, "unknown operator: %s %s %s",
+				typeName(left), ie.Operator, typeName(right))
+		}
+		return right, nil
+	}
+
+	right, err := e.Eval(ie.Right, env)
+	if err != nil {
+		return nil, err
+	}
+
+	switch ie.Operator {
+	case "&":
+		return unify(ie.Token, left, right)
+	case "==":
+		return newBoolean(ie.Token, equal(left, right)), nil
+	case "!=":
+		return newBoolean(ie.Token, !equal(left, right)), nil
+	}
+
+	if ie.Operator == "+" {
+		l, lok := left.(*ast.ObjectValue)
+		r, rok := right.(*ast.ObjectValue)
+		if lok && rok {
+			return e.mergeObjects(Step{Kind: StepMerge, File: env.file, Token: ie.Token}, l, r)
+		}
+		return add(ie.Token, left, right)
+	}
+
+	if v, ok, err := evalUnitInfixExpression(ie, left, right); ok {
+		return v, err
+	}
+
+	switch l := left.(type) {
+	case *ast.NumberValue:
+		if r, ok := right.(*ast.NumberValue); ok {
+			return evalNumberInfixExpression(ie, l.Value, r.Value)
+		}
+	case *ast.StringValue:
+		if r, ok := right.(*ast.StringValue); ok {
+			return evalStringInfixExpression(ie, l.Value, r.Value)
+		}
+	}
+
+	return nil, newError(ie.Token, "unknown operator: %s %s %s",
+		typeName(left), ie.Operator, typeName(right))
+}
+
+func evalNumberInfixExpression(ie *ast.InfixExpression, left, right float64) (ast.Value, error) {
+	switch ie.Operator {
+	case "-":
+		return newNumber(ie.Token, left-right), nil
+	case "*":
+		return newNumber(ie.Token, left*right), nil
+	case "/":
+		if right == 0 {
+			return nil, newError(ie.Token, "division by zero")
+		}
+		return newNumber(ie.Token, left/right), nil
+	case "%":
+		if right == 0 {
+			return nil, newError(ie.Token, "division by zero")
+		}
+		return newNumber(ie.Token, math.Mod(left, right)), nil
+	case "<":
+		return newBoolean(ie.Token, left < right), nil
+	case ">":
+		return newBoolean(ie.Token, left > right), nil
+	case "<=":
+		return newBoolean(ie.Token, left <= right), nil
+	case ">=":
+		return newBoolean(ie.Token, left >= right), nil
+	}
+	return nil, newError(ie.Token, "unknown operator: number %s number", ie.Operator)
+}
+
+func evalStringInfixExpression(ie *ast.InfixExpression, left, right string) (ast.Value, error) {
+	switch ie.Operator {
+	case "<":
+		return newBoolean(ie.Token, left < right), nil
+	case ">":
+		return newBoolean(ie.Token, left > right), nil
+	case "<=":
+		return newBoolean(ie.Token, left <= right), nil
+	case ">=":
+		return newBoolean(ie.Token, left >= right), nil
+	}
+	return nil, newError(ie.Token, "unknown operator: string %s string", ie.Operator)
+}
+
+func (e *Evaluator) evalMemberExpression(me *ast.MemberExpression, env *Environment) (ast.Value, error) {
+	var v ast.Value
+	var ok bool
+	var err error
+	if isLate(me.Object) {
+		v, ok, err = e.selectLate(me.Object, me.Property.Value, env)
+	} else {
+		var object ast.Value
+		if object, err = e.Eval(me.Object, env); err != nil {
+			return nil, err
+		}
+		v, ok, err = selectField(me, object)
+	}
+	if err != nil || ok {
+		return v, err
+	}
+	if me.Optional {
+		return newNull(me.Token), nil
+	}
+	if isLate(me.Object) {
+		return nil, lateNotFound(me.Object, me.Property.Token, me.Property.Value, env)
+	}
+	return nil, newError(me.Property.Token, "field %s not found", me.Property.Value)
+}
+
+// isLate reports whether node is self or super, whose fields are selected
+// without evaluating them as a whole.
+func isLate(node ast.Value) bool {
+	switch node.(type) {
+	case *ast.SelfExpression, *ast.SuperExpression:
+		return true
+	}
+	return false
+}
+
+// selectField returns the field of object selected by me. ok is false when
+// there is no such field, which is only an error for objects or, unless the
+// selection is optional, for other values.
+func selectField(me *ast.MemberExpression, object ast.Value) (ast.Value, bool, error) {
+	ov, ok := object.(*ast.ObjectValue)
+	if !ok {
+		if me.Optional {
+			return nil, false, nil
+		}
+		return nil, false, newError(me.Token, "cannot select field %s of %s", me.Property.Value, typeName(object))
+	}
+	v, ok := lookup(ov, me.Property.Value)
+	return v, ok, nil
+}
+
+func (e *Evaluator) evalIndexExpression(ie *ast.IndexExpression, env *Environment) (ast.Value, error) {
+	if isLate(ie.Left) {
+		return e.evalLateIndex(ie, env)
+	}
+
+	left, err := e.Eval(ie.Left, env)
+	if err != nil {
+		return nil, err
+	}
+	return e.index(ie, left, env)
+}
+
+// index returns the element of left, the value of the left operand of ie, at
+// the index of ie.
+func (e *Evaluator) index(ie *ast.IndexExpression, left ast.Value, env *Environment) (ast.Value, error) {
+	if _, null := left.(*ast.NullValue); null && ie.Optional {
+		return newNull(ie.Token), nil
+	}
+	index, err := e.Eval(ie.Index, env)
+	if err != nil {
+		return nil, err
+	}
+
+	if ov, ok := left.(*ast.ObjectValue); ok {
+		key, ok := index.(*ast.StringValue)
+		if !ok {
+			return nil, newError(ie.Token, "object index must be a string, got %s", typeName(index))
+		}
+		if v, ok := lookup(ov, key.Value); ok {
+			return v, nil
+		}
+		if ie.Optional {
+			return newNull(ie.Token), nil
+		}
+		return nil, newError(ie.Token, "field %s not found", show(key))
+	}
+
+	var length int
+	switch l := left.(type) {
+	case *ast.ArrayValue:
+		length = len(l.Values)
+	case *ast.StringValue:
+		length = utf8.RuneCountInString(l.Value)
+	default:
+		return nil, newError(ie.Token, "cannot index %s", typeName(left))
+	}
+
+	i, err := indexArg(ie.Token, index)
+	if err != nil {
+		return nil, err
+	}
+	if i < 0 {
+		i += length
+	}
+	if i < 0 || i >= length {
+		if ie.Optional {
+			return newNull(ie.Token), nil
+		}
+		return nil, newError(ie.Token, "index %s out of range for %s of length %d", index.String(), typeName(left), length)
+	}
+
+	if s, ok := left.(*ast.StringValue); ok {
+		return markSecret(newString(ie.Token, string([]rune(s.Value)[i])), s), nil
+	}
+	return left.(*ast.ArrayValue).Values[i], nil
+}
+
+// evalLateIndex evaluates self[key] or super[key].
+func (e *Evaluator) evalLateIndex(ie *ast.IndexExpression, env *Environment) (ast.Value, error) {
+	index, err := e.Eval(ie.Index, env)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := index.(*ast.StringValue)
+	if !ok {
+		return nil, newError(ie.Token, "object index must be a string, got %s", typeName(index))
+	}
+
+	v, ok, err := e.selectLate(ie.Left, key.Value, env)
+	if err != nil || ok {
+		return v, err
+	}
+	if ie.Optional {
+		return newNull(ie.Token), nil
+	}
+	return nil, lateNotFound(ie.Left, ie.Token, showName(key), env)
+}
+
+func (e *Evaluator) evalSliceExpression(se *ast.SliceExpression, env *Environment) (ast.Value, error) {
+	left, err := e.Eval(se.Left, env)
+	if err != nil {
+		return nil, err
+	}
+
+	var length int
+	switch l := left.(type) {
+	case *ast.ArrayValue:
+		length = len(l.Values)
+	case *ast.StringValue:
+		length = utf8.RuneCountInString(l.Value)
+	default:
+		return nil, newError(se.Token, "cannot slice %s", typeName(left))
+	}
+
+	bounds := []int{0, length}
+	written := []string{"", ""}
+	for n, bound := range []ast.Value{se.Low, se.High} {
+		if bound == nil {
+			continue
+		}
+		v, err := e.Eval(bound, env)
+		if err != nil {
+			return nil, err
+		}
+		i, err := indexArg(se.Token, v)
+		if err != nil {
+			return nil, err
+		}
+		written[n] = v.String()
+		if i < 0 {
+			i += length
+		}
+		bounds[n] = i
+	}
+	low, high := bounds[0], bounds[1]
+	if low < 0 || high > length || low > high {
+		return nil, newError(se.Token, "slice [%s:%s] out of range for %s of length %d", written[0], written[1], typeName(left), length)
+	}
+
+	if s, ok := left.(*ast.StringValue); ok {
+		return markSecret(newString(se.Token, string([]rune(s.Value)[low:high])), s), nil
+	}
+	values := append([]ast.Value{}, left.(*ast.ArrayValue).Values[low:high]...)
+	return &ast.ArrayValue{Token: se.Token, Values: values}, nil
+}
+
+// indexArg returns the index v, which must be an integral number.
+func indexArg(tok token.Token, v ast.Value) (int, error) {
+	n, ok := v.(*ast.NumberValue)
+	if !ok || n.Value != math.Trunc(n.Value) {
+		return 0, newError(tok, "index must be an integer, got %s", show(v))
+	}
+	return int(n.Value), nil
+}
+
+// evalCoalesce evaluates a ?? b, which is b when a is null or missing: an
+// undefined identifier or a field that is not found.
+func (e *Evaluator) evalCoalesce(ie *ast.InfixExpression, env *Environment) (ast.Value, error) {
+	left, err := e.evalMissing(ie.Left, env)
+	if err != nil {
+		return nil, err
+	}
+	if _, null := left.(*ast.NullValue); left != nil && !null {
+		return left, nil
+	}
+	return e.Eval(ie.Right, env)
+}
+
+// evalMissing is like Eval, but returns nil when node is an identifier that is
+// not defined, or selects a field or an element missing along its path.
+func (e *Evaluator) evalMissing(node ast.Value, env *Environment) (ast.Value, error) {
+	switch node := node.(type) {
+	case *ast.Identifier:
+		if _, ok := env.get(node.Value); !ok {
+			return nil, nil
+		}
+	case *ast.MemberExpression:
+		if isLate(node.Object) {
+			v, _, err := e.selectLate(node.Object, node.Property.Value, env)
+			return v, err
+		}
+		object, err := e.evalMissing(node.Object, env)
+		if _, null := object.(*ast.NullValue); err != nil || object == nil || null {
+			return nil, err
+		}
+		v, _, err := selectField(node, object)
+		return v, locate(err, env)
+	case *ast.IndexExpression:
+		if isLate(node.Left) {
+			break
+		}
+		left, err := e.evalMissing(node.Left, env)
+		if _, null := left.(*ast.NullValue); err != nil || left == nil || null {
+			return nil, err
+		}
+		optional := *node
+		optional.Optional = true
+		return e.index(&optional, left, env)
+	}
+	return e.Eval(node, env)
+}
+
+// lookup returns the value of the attribute key of ov.
+func lookup(ov *ast.ObjectValue, key string) (ast.Value, bool) {
+	for _, att := range ov.Attributes {
+		if att.Key == key {
+			return att.V, true
+		}
+	}
+	return nil, false
+}
+
+// evalTryExpression evaluates the value of te, or its fallback when that fails
+// with an evaluation error. Errors stopping the evaluation as a whole, such as
+// limits and cancellation, are not caught.
+func (e *Evaluator) evalTryExpression(te *ast.TryExpression, env *Environment) (ast.Value, error) {
+	v, err := e.Eval(te.Value, env)
+	if err == nil {
+		return v, nil
+	}
+
+	var ee *Error
+	var steps *StepLimitError
+	var depth *DepthLimitError
+	if !errors.As(err, &ee) || errors.As(err, &steps) || errors.As(err, &depth) ||
+		errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return nil, err
+	}
+	// The cause of err can hide that the evaluation is canceled
+	if e.ctx != nil && e.ctx.Err() != nil {
+		return nil, err
+	}
+
+	fallbackEnv := env
+	if te.Name != nil {
+		fallbackEnv = NewEnclosedEnvironment(env)
+		fallbackEnv.Set(te.Name.Value, newString(te.Token, ee.Message))
+	}
+	return e.Eval(te.Fallback, fallbackEnv)
+}
+
+func (e *Evaluator) evalIfExpression(ie *ast.IfExpression, env *Environment) (ast.Value, error) {
+	condition, err := e.Eval(ie.Condition, env)
+	if err != nil {
+		return nil, err
+	}
+
+	b, ok := condition.(*ast.BooleanValue)
+	if !ok {
+		return nil, newError(ie.Token, "condition must be a boolean, got %s", typeName(condition))
+	}
+
+	if b.Value {
+		return e.Eval(ie.Consequence, env)
+	}
+	return e.Eval(ie.Alternative, env)
+}
+
+// namedArgument is an evaluated name = value call argument.
+type namedArgument struct {
+	name  *ast.Identifier
+	value ast.Value
+}
+
+func (e *Evaluator) evalCallExpression(ce *ast.CallExpression, env *Environment) (ast.Value, error) {
+	callee, err := e.Eval(ce.Function, env)
+	if err != nil {
+		return nil, err
+	}
+
+	args := []ast.Value{}
+	named := []namedArgument{}
+	for _, a := range ce.Arguments {
+		v, err := e.Eval(a.Value, env)
+		if err != nil {
+			return nil, err
+		}
+		if a.Name != nil {
+			named = append(named, namedArgument{name: a.Name, value: v})
+		} else {
+			args = append(args, v)
+		}
+	}
+
+	if err := e.step(ce.Token); err != nil {
+		return nil, err
+	}
+
+	var result ast.Value
+	switch fn := callee.(type) {
+	case *Function:
+		if e.depth >= e.maxDepth {
+			return nil, wrapError(ce.Token, &DepthLimitError{Limit: e.maxDepth})
+		}
+		e.depth++
+		defer func() { e.depth-- }()
+
+		result, err = e.applyFunction(fn, ce.Token, args, named)
+
+	case *Builtin:
+		if len(named) > 0 {
+			return nil, newError(named[0].name.Token, "%s does not take named arguments", fn.Value)
+		}
+		if err := fn.checkArguments(ce.Token, args); err != nil {
+			return nil, err
+		}
+		result, err = fn.Fn(e, ce.Token, args)
+		if err == nil {
+			result = markSecret(result, args...)
+		}
+
+	default:
+		return nil, newError(ce.Token, "%s is not a function, got %s", ce.Function.String(), typeName(callee))
+	}
+	if err != nil {
+		if ee, ok := err.(*Error); ok {
+			ee.Trace = append(ee.Trace, Frame{Name: ce.Function.String(), File: env.file, Token: ce.Token})
+		}
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// applyFunction binds the arguments to the parameters of fn and evaluates its
+// body. Parameters left unbound take their default value.
+func (e *Evaluator) applyFunction(fn *Function, tok token.Token, args []ast.Value, named []namedArgument) (ast.Value, error) {
+	if len(args) > len(fn.Parameters) {
+		return nil, newError(tok, "too many arguments: want %d, got %d", len(fn.Parameters), len(args))
+	}
+
+	callEnv := newCallEnvironment(fn.Env)
+	for i, param := range fn.Parameters {
+		if i < len(args) {
+			callEnv.Set(param.Name.Value, args[i])
+		}
+	}
+
+	for _, a := range named {
+		i := parameterIndex(fn, a.name.Value)
+		if i < 0 {
+			return nil, newError(a.name.Token, "unknown argument %s", a.name.Value)
+		}
+		if _, ok := callEnv.store[a.name.Value]; ok {
+			return nil, newError(a.name.Token, "argument %s given twice", a.name.Value)
+		}
+		callEnv.Set(a.name.Value, a.value)
+	}
+
+	for _, param := range fn.Parameters {
+		if _, ok := callEnv.store[param.Name.Value]; ok {
+			continue
+		}
+		if param.Default == nil {
+			return nil, newError(tok, "missing argument %s", param.Name.Value)
+		}
+		callEnv.setLazy(param.Name.Value, param.Default, callEnv)
+	}
+
+	return e.Eval(fn.Body, callEnv)
+}
+
+func parameterIndex(fn *Function, name string) int {
+	for i, param := range fn.Parameters {
+		if param.Name.Value == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func (e *Evaluator) evalArrayComprehension(ac *ast.ArrayComprehension, env *Environment) (ast.Value, error) {
+	result := &ast.ArrayValue{Token: ac.Token, Values: []ast.Value{}}
+
+	err := e.evalForClause(ac.For, env, func(scope *Environment) error {
+		v, err := e.Eval(ac.Body, scope)
+		if err != nil {
+			return err
+		}
+		result.Values = append(result.Values, v)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (e *Evaluator) evalObjectComprehension(oc *ast.ObjectComprehension, env *Environment) (ast.Value, error) {
+	result := &ast.ObjectValue{Token: oc.Token, Attributes: []ast.Attribute{}}
+	seen := make(map[string]bool)
+
+	err := e.evalForClause(oc.For, env, func(scope *Environment) error {
+		k, err := e.Eval(oc.Key, scope)
+		if err != nil {
+			return err
+		}
+		key, ok := k.(*ast.StringValue)
+		if !ok {
+			return newError(oc.For.Token, "object key must be a string, got %s", typeName(k))
+		}
+		if key.Secret {
+			return newError(oc.For.Token, "object key cannot be a secret")
+		}
+		if seen[key.Value] {
+			return newError(oc.For.Token, "duplicate key %q", key.Value)
+		}
+		seen[key.Value] = true
+
+		v, err := e.Eval(oc.Body, scope)
+		if err != nil {
+			return err
+		}
+		result.Attributes = append(result.Attributes, ast.Attribute{Token: key.Token, Key: key.Value, V: v})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// evalForClause calls yield with a scope binding the clause variables, once for
+// every element of the iterable that passes the filter. Over an array the key
+// is the index, over an object it is the attribute key.
+func (e *Evaluator) evalForClause(fc *ast.ForClause, env *Environment, yield func(*Environment) error) error {
+	iterable, err := e.Eval(fc.Iterable, env)
+	if err != nil {
+		return err
+	}
+
+	var keys, values []ast.Value
+	switch it := iterable.(type) {
+	case *ast.ArrayValue:
+		for i, v := range it.Values {
+			keys = append(keys, newNumber(fc.Token, float64(i)))
+			values = append(values, v)
+		}
+	case *ast.ObjectValue:
+		for _, att := range visibleAttributes(it) {
+			keys = append(keys, newString(att.Token, att.Key))
+			values = append(values, att.V)
+		}
+	default:
+		return newError(fc.Token, "cannot iterate over %s", typeName(iterable))
+	}
+
+	for i := range values {
+		if err := e.step(fc.Token); err != nil {
+			return err
+		}
+
+		scope := NewEnclosedEnvironment(env)
+		if fc.Key != nil {
+			scope.Set(fc.Key.Value, keys[i])
+		}
+		scope.Set(fc.Value.Value, values[i])
+
+		if fc.Filter != nil {
+			cond, err := e.Eval(fc.Filter, scope)
+			if err != nil {
+				return err
+			}
+			b, ok := cond.(*ast.BooleanValue)
+			if !ok {
+				return newError(fc.Token, "filter must be a boolean, got %s", typeName(cond))
+			}
+			if !b.Value {
+				continue
+			}
+		}
+
+		if err := yield(scope); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// equal reports whether a and b are the same value, comparing arrays and
+// objects element by element.
+func equal(a, b ast.Value) bool {
+	switch a := a.(type) {
+	case *ast.NumberValue:
+		b, ok := b.(*ast.NumberValue)
+		return ok && a.Value == b.Value
+	case *ast.StringValue:
+		b, ok := b.(*ast.StringValue)
+		return ok && a.Value == b.Value
+	case *ast.BooleanValue:
+		b, ok := b.(*ast.BooleanValue)
+		return ok && a.Value == b.Value
+	case *ast.NullValue:
+		_, ok := b.(*ast.NullValue)
+		return ok
+	case *ast.DurationValue:
+		b, ok := b.(*ast.DurationValue)
+		return ok && a.Value == b.Value
+	case *ast.ByteSizeValue:
+		b, ok := b.(*ast.ByteSizeValue)
+		return ok && a.Value == b.Value
+	case *ast.TimestampValue:
+		b, ok := b.(*ast.TimestampValue)
+		return ok && a.Value.Equal(b.Value)
+	case *ast.RegexValue:
+		b, ok := b.(*ast.RegexValue)
+		return ok && a.Regexp.String() == b.Regexp.String()
+	case *ast.ArrayValue:
+		b, ok := b.(*ast.ArrayValue)
+		if !ok || len(a.Values) != len(b.Values) {
+			return false
+		}
+		for i := range a.Values {
+			if !equal(a.Values[i], b.Values[i]) {
+				return false
+			}
+		}
+		return true
+	case *ast.ObjectValue:
+		b, ok := b.(*ast.ObjectValue)
+		if !ok {
+			return false
+		}
+		av, bv := visibleAttributes(a), visibleAttributes(b)
+		if len(av) != len(bv) {
+			return false
+		}
+		for _, att := range av {
+			v, ok := lookup(b, att.Key)
+			if !ok || !equal(att.V, v) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func typeName(v ast.Value) string {
+	switch v.(type) {
+	case *ast.NumberValue:
+		return "number"
+	case *ast.StringValue:
+		return "string"
+	case *ast.BooleanValue:
+		return "boolean"
+	case *ast.NullValue:
+		return "null"
+	case *ast.DurationValue:
+		return "duration"
+	case *ast.ByteSizeValue:
+		return "bytesize"
+	case *ast.TimestampValue:
+		return "timestamp"
+	case *ast.RegexValue:
+		return "regex"
+	case *ast.ArrayValue:
+		return "array"
+	case *ast.ObjectValue:
+		return "object"
+	case *Function, *Builtin:
+		return "function"
+	case *ast.TypeConstraint, *ast.BoundConstraint, *ast.Disjunction, *ast.Conjunction:
+		return "constraint"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func newNumber(tok token.Token, v float64) *ast.NumberValue {
+	lit := strconv.FormatFloat(v, 'f', -1, 64)
+	if abs := math.Abs(v); abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		lit = strconv.FormatFloat(v, 'g', -1, 64)
+	}
+	return &ast.NumberValue{
+		Token: token.Token{Type: token.NUMBER, Literal: lit, Line: tok.Line, Column: tok.Column},
+		Value: v,
+	}
+}
+
+func newString(tok token.Token, s string) *ast.StringValue {
+	return &ast.StringValue{
+		Token: token.Token{Type: token.STRING, Literal: ast.Escape(s), Line: tok.Line, Column: tok.Column},
+		Value: s,
+	}
+}
+
+func newNull(tok token.Token) *ast.NullValue {
+	return &ast.NullValue{Token: token.Token{Type: token.NULL, Literal: "null", Line: tok.Line, Column: tok.Column}}
+}
+
+func newBoolean(tok token.Token, b bool) *ast.BooleanValue {
+	t := token.Token{Type: token.FALSE, Literal: "false", Line: tok.Line, Column: tok.Column}
+	if b {
+		t.Type, t.Literal = token.TRUE, "true"
+	}
+	return &ast.BooleanValue{Token: t, Value: b}
+}
@@ -0,0 +1,607 @@
+package evaluator
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/salleaffaire/ynt/ast"
+	"github.com/salleaffaire/ynt/lexer"
+	"github.com/salleaffaire/ynt/parser"
+)
+
+func testEval(t *testing.T, input string) (ast.Value, error) {
+	t.Helper()
+
+	l := lexer.New(input)
+	if l == nil {
+		t.Fatalf("lexer failed on %q", input)
+	}
+	p := parser.New(l)
+	document := p.ParseDocument()
+	if document == nil {
+		t.Fatalf("parser failed on %q: %v", input, p.Errors)
+	}
+
+	return New().EvalDocument(document)
+}
+
+func testEvalString(t *testing.T, tests []struct {
+	input    string
+	expected string
+}) {
+	t.Helper()
+
+	for _, tt := range tests {
+		evaluated, err := testEval(t, tt.input)
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", tt.input, err)
+			continue
+		}
+		if evaluated.String() != tt.expected {
+			t.Errorf("%q: expected=%q, got=%q", tt.input, tt.expected, evaluated.String())
+		}
+	}
+}
+
+func testEvalError(t *testing.T, tests []struct {
+	input    string
+	expected string
+}) {
+	t.Helper()
+
+	for _, tt := range tests {
+		_, err := testEval(t, tt.input)
+		if err == nil {
+			t.Errorf("%q: expected an error", tt.input)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("%q: expected error containing %q, got=%q", tt.input, tt.expected, err.Error())
+		}
+	}
+}
+
+func TestEvalExpressions(t *testing.T) {
+	testEvalString(t, []struct {
+		input    string
+		expected string
+	}{
+		{"1 + 2 * 3", "7"},
+		{"(1 + 2) * 3", "9"},
+		{"10 - 4 - 3", "3"},
+		{"7 % 4", "3"},
+		{"-(2 + 3)", "-5"},
+		{"\"a\" + \"b\"", "\"ab\""},
+		{"[1] + [2, 3]", "[1, 2, 3]"},
+		{"1 < 2 && !(2 <= 1)", "true"},
+		{"false || 3 >= 3", "true"},
+		{"[1, {\"a\": 2}] == [1, {\"a\": 2}]", "true"},
+		{"{a: 1, b: a + 1}", "{\"a\":1, \"b\":2}"},
+		{"{b: a + 1, a: 1}", "{\"b\":2, \"a\":1}"},
+		{"{x: {y: 3}, z: x.y}", "{\"x\":{\"y\":3}, \"z\":3}"},
+		{"{n: 2, inner: {m: n * 2}}", "{\"n\":2, \"inner\":{\"m\":4}}"},
+	})
+}
+
+func TestEvalIndex(t *testing.T) {
+	testEvalString(t, []struct {
+		input    string
+		expected string
+	}{
+		{`[10, 20, 30][0]`, `10`},
+		{`[10, 20, 30][-1]`, `30`},
+		{`[10, 20, 30, 40][1:3]`, `[20, 30]`},
+		{`[10, 20, 30][1:]`, `[20, 30]`},
+		{`[10, 20, 30][:-1]`, `[10, 20]`},
+		{`[10, 20, 30][3:]`, `[]`},
+		{`"héllo wörld"[0:8]`, `"héllo wö"`},
+		{`"héllo"[1]`, `"é"`},
+		{`{a: {b: [1, [2, 3]]}}.a.b[1][0]`, `2`},
+		{`{a: 1}["a"]`, `1`},
+		{`{xs: [1]}.xs?.[5] ?? 0`, `0`},
+		{`{m: null}.m?.[0]`, `null`},
+	})
+}
+
+func TestEvalIndexErrors(t *testing.T) {
+	testEvalError(t, []struct {
+		input    string
+		expected string
+	}{
+		{`[1, 2, 3][3]`, "index 3 out of range for array of length 3"},
+		{`[1, 2, 3][-4]`, "index -4 out of range for array of length 3"},
+		{`"héllo"[5]`, "index 5 out of range for string of length 5"},
+		{`[1, 2, 3][1:5]`, "slice [1:5] out of range for array of length 3"},
+		{`"abc"[2:1]`, "slice [2:1] out of range for string of length 3"},
+		{`[1][0.5]`, "index must be an integer, got 0.5"},
+		{`[1]["a"]`, `index must be an integer, got "a"`},
+		{`{a: 1}[0]`, "object index must be a string, got number"},
+		{`{a: 1}["b"]`, `field "b" not found`},
+		{`[1, 2, 3][-5:]`, "slice [-5:] out of range for array of length 3"},
+		{`[1, 2, 3][1:-3]`, "slice [1:-3] out of range for array of length 3"},
+		{`1[0]`, "cannot index number"},
+		{`true[0:1]`, "cannot slice boolean"},
+	})
+}
+
+func TestEvalNull(t *testing.T) {
+	testEvalString(t, []struct {
+		input    string
+		expected string
+	}{
+		{`{a: null, b: null == null, c: [null] == [null], d: null != 0}`, `{"a":null, "b":true, "c":true, "d":true}`},
+		{`{cfg: {db: {host: "h"}}, a: cfg?.db?.host, b: cfg?.cache?.size}.b`, `null`},
+		{`{cfg: {db: {host: "h"}}, a: cfg?.db?.host}.a`, `"h"`},
+		{`{xs: [1], a: xs?.length}.a`, `null`},
+		{`{cfg: {}, a: cfg.cache.size ?? 64}.a`, `64`},
+		{`{cfg: {port: null}, a: cfg.port ?? 80}.a`, `80`},
+		{`undefined ?? "default"`, `"default"`},
+		{`[false ?? true, 0 ?? 1, "" ?? "x"]`, `[false, 0, ""]`},
+		{`null ?? null ?? 3`, `3`},
+		{`{xs: [1, 2], a: [xs[5] ?? 0, xs[-1] ?? 0]}.a`, `[0, 2]`},
+		{`{o: {k: null}, a: [o["x"] ?? 1, o["k"] ?? 2]}.a`, `[1, 2]`},
+		{`{cfg: {hosts: []}, a: cfg.hosts[0].name ?? "localhost"}.a`, `"localhost"`},
+	})
+}
+
+func TestEvalNullErrors(t *testing.T) {
+	testEvalError(t, []struct {
+		input    string
+		expected string
+	}{
+		{`null + 1`, "unknown operator: null + number"},
+		{`{a: null, b: a.c}`, "cannot select field c of null"},
+		{`{a: 1, b: a.x ?? 2}`, "cannot select field x of number"},
+		{`{a: {}, b: a?.c.d}`, "cannot select field d of null"},
+		{`{a: {}, b: a.c}`, "field c not found"},
+		{`{a: 1, b: a[0] ?? 2}`, "cannot index number"},
+	})
+}
+
+func TestEvalComprehensions(t *testing.T) {
+	testEvalString(t, []struct {
+		input    string
+		expected string
+	}{
+		{"[for x in [1, 2, 3]: x * 2]", "[2, 4, 6]"},
+		{"[for x in [1, 2, 3, 4]: x if x % 2 == 0]", "[2, 4]"},
+		{"[for i, x in [\"a\", \"b\"]: i]", "[0, 1]"},
+		{"[for v in {a: 1, b: 2}: v]", "[1, 2]"},
+		{"{for k, v in {a: 1, b: 2}: k: v + 1}", "{\"a\":2, \"b\":3}"},
+		{"{for k, v in {a: 1, b: 2}: k: v if v > 1}", "{\"b\":2}"},
+		{"{for s in [{name: \"web\", port: 80}]: s.name: s.port}", "{\"web\":80}"},
+		{"{names: [\"a\", \"b\"], ports: {for n in names: n: 80}}",
+			"{\"names\":[\"a\", \"b\"], \"ports\":{\"a\":80, \"b\":80}}"},
+	})
+}
+
+func TestEvalComprehensionValues(t *testing.T) {
+	evaluated, err := testEval(t, "[for x in [1, 2]: {id: x}]")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	array, ok := evaluated.(*ast.ArrayValue)
+	if !ok {
+		t.Fatalf("evaluated not *ast.ArrayValue. got=%T", evaluated)
+	}
+	if len(array.Values) != 2 {
+		t.Fatalf("array does not contain 2 values. got=%d", len(array.Values))
+	}
+	if _, ok := array.Values[0].(*ast.ObjectValue); !ok {
+		t.Fatalf("array.Values[0] not *ast.ObjectValue. got=%T", array.Values[0])
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	testEvalError(t, []struct {
+		input    string
+		expected string
+	}{
+		{"1 + true", "unknown operator: number + boolean - line 1 column 3"},
+		{"{a: b}", "identifier not found: b"},
+		{"{a: b, b: a}", "cycle in reference to"},
+		{"{a: 1, a: 2}", "duplicate key \"a\""},
+		{"[for x in 1: x]", "cannot iterate over number"},
+		{"[for x in [1]: x if x]", "filter must be a boolean"},
+		{"{for x in [1]: x: x}", "object key must be a string, got number"},
+		{"{for x in [\"a\", \"a\"]: x: 1}", "duplicate key \"a\""},
+		{"1 / 0", "division by zero"},
+	})
+}
+
+func TestEvalFunctions(t *testing.T) {
+	testEvalString(t, []struct {
+		input    string
+		expected string
+	}{
+		{"{add: function(a, b) a + b, x: add(1, 2)}.x", "3"},
+		{"{svc: function(name, port = 80) {name: name, port: port}, x: svc(\"web\")}.x",
+			"{\"name\":\"web\", \"port\":80}"},
+		{"{svc: function(name, port = 80) {name: name, port: port}, x: svc(\"db\", port = 5432)}.x",
+			"{\"name\":\"db\", \"port\":5432}"},
+		{"{svc: function(name, port) port, x: svc(port = 1, name = \"a\")}.x", "1"},
+		{"{f: function(a, b = a * 2) b, x: f(3)}.x", "6"},
+		{"{base: 10, f: function(n) n + base, x: f(1)}.x", "11"},
+		{"{mk: function(n) function(m) n * m, x: mk(3)(4)}.x", "12"},
+		{"{fact: function(n) if n <= 1 then 1 else n * fact(n - 1), x: fact(5)}.x", "120"},
+		{"{double: function(x) x * 2, x: [for n in [1, 2]: double(n)]}.x", "[2, 4]"},
+		{"if 1 > 2 then \"a\" else \"b\"", "\"b\""},
+	})
+}
+
+func TestEvalFunctionErrors(t *testing.T) {
+	testEvalError(t, []struct {
+		input    string
+		expected string
+	}{
+		{"{f: function(a) a, x: f()}", "missing argument a"},
+		{"{f: function(a) a, x: f(1, 2)}", "too many arguments: want 1, got 2"},
+		{"{f: function(a) a, x: f(b = 1)}", "unknown argument b"},
+		{"{f: function(a) a, x: f(1, a = 2)}", "argument a given twice"},
+		{"{f: 1, x: f(1)}", "f is not a function, got number"},
+		{"{f: function(n) f(n + 1), x: f(0)}", "maximum call depth of 1000 exceeded"},
+		{"if 1 then 2 else 3", "condition must be a boolean"},
+	})
+}
+
+func TestEvalStackTrace(t *testing.T) {
+	input := `{
+  inner: function(n) n / 0,
+  outer: function(n) inner(n),
+  x: outer(1)
+}`
+	_, err := testEval(t, input)
+	if err == nil {
+		t.Fatalf("expected an error")
+	}
+
+	evalErr, ok := err.(*Error)
+	if !ok {
+		t.Fatalf("err not *Error. got=%T", err)
+	}
+
+	expected := "Error: division by zero - line 2 column 24\n" +
+		"\tat inner - line 3 column 27\n" +
+		"\tat outer - line 4 column 11"
+	if evalErr.Error() != expected {
+		t.Errorf("expected=%q, got=%q", expected, evalErr.Error())
+	}
+}
+
+func TestEvalBuiltins(t *testing.T) {
+	testEvalString(t, []struct {
+		input    string
+		expected string
+	}{
+		{`upper("web")`, `"WEB"`},
+		{`lower("WeB")`, `"web"`},
+		{`trim("  a b ")`, `"a b"`},
+		{`split("a,b,c", ",")`, `["a", "b", "c"]`},
+		{`join(["a", "b"], "-")`, `"a-b"`},
+		{`replace("a.b.c", ".", "/")`, `"a/b/c"`},
+		{`replace("v1.24.3", re"^v(\d+)\.\d+", "v$1.0")`, `"v1.0.3"`},
+		{`[matches("web-01", re"^[a-z]+-\d+$"), matches("web", "^\\d")]`, `[true, false]`},
+		{`find("a1b22c333", re"\d+")`, `["1", "22", "333"]`},
+		{`captures("v1.24", re"^v(\d+)\.(\d+)(-rc)?")`, `["1", "24", ""]`},
+		{`captures("v1.24", re"^v(?P<major>\d+)\.(?P<minor>\d+)")`, `{"major":"1", "minor":"24"}`},
+		{`[captures("x", re"(\d)"), find("x", "\\d")]`, `[[], []]`},
+		{`{pattern: re"^a\"b$"}`, `{"pattern":"^a\\\"b$"}`},
+		{`format("%s:%d", "host", 8080)`, `"host:8080"`},
+		{`format("%05.1f%%", 3.14159)`, `"003.1%"`},
+		{`format("%v", [1, "a"])`, `"[1, \"a\"]"`},
+		{`[base64Encode("hunter2"), base64Decode("aHVudGVyMg==")]`, `["aHVudGVyMg==", "hunter2"]`},
+		{`[hexEncode("hi"), hexDecode("6869")]`, `["6869", "hi"]`},
+		{`sha1("abc")`, `"a9993e364706816aba3e25717850c26c9cd0d89d"`},
+		{`sha256("abc")`, `"ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"`},
+		{`length(sha512("abc"))`, `128`},
+		{`sha256({b: 1.0, a: [1, "x"], h:: 2}) == sha256({a: [1, "x"], b: 1})`, `true`},
+		{`sha256({a: [1, "x"], b: 1})`, `"a88dede55f330dbae7d6c99cb78c43213f114625ed11c8fd0b769d117c06bb50"`},
+		{`uuidv5("dns", "www.example.com")`, `"2ed6657d-e927-568b-95e1-2665a8aea6a2"`},
+		{`uuidv5("6ba7b811-9dad-11d1-80b4-00c04fd430c8", "https://example.com")`, `"4fd35a71-71ef-5a55-a9d9-aa75c889a6d0"`},
+		{`min(3, 1, 2)`, `1`},
+		{`max(3, 1, 2)`, `3`},
+		{`floor(1.5) + ceil(1.5) + abs(-1)`, `4`},
+		{`length("héllo")`, `5`},
+		{`length([1, 2]) + length({a: 1})`, `3`},
+		{`keys({b: 1, a: 2})`, `["b", "a"]`},
+		{`values({b: 1, a: 2})`, `[1, 2]`},
+		{`sort([3, 1, 2])`, `[1, 2, 3]`},
+		{`sort(["b", "c", "a"])`, `["a", "b", "c"]`},
+		{`uniq([1, 2, 1, [1], [1]])`, `[1, 2, [1]]`},
+		{`flatten([[1, 2], 3, [[4]]])`, `[1, 2, 3, [4]]`},
+		{`range(0, 3)`, `[0, 1, 2]`},
+		{`zip([1, 2, 3], ["a", "b"])`, `[[1, "a"], [2, "b"]]`},
+		{`[isNumber(1), isString(1), isBoolean(true), isArray([]), isObject({}), isFunction(upper)]`,
+			`[true, false, true, true, true, true]`},
+		{`{upper: function(s) s, x: upper("a")}.x`, `"a"`},
+		{`upper("a\"b\n")`, `"A\"B\n"`},
+		{`length("a\nb")`, `3`},
+	})
+}
+
+func TestEvalBuiltinErrors(t *testing.T) {
+	testEvalError(t, []struct {
+		input    string
+		expected string
+	}{
+		{`upper(1)`, "argument s of upper must be string, got number"},
+		{`upper()`, "wrong number of arguments to upper: got 0, want upper(s string) string"},
+		{`length(1)`, "argument v of length must be string or array or object, got number"},
+		{`min(1, "a")`, "argument rest of min must be number, got string"},
+		{`join([1], ",")`, "join: elements must be strings, got number"},
+		{`sort([1, "a"])`, "sort: cannot compare"},
+		{`format("%d", 1.5)`, "format: %d needs an integer, got 1.5"},
+		{`format("%s %s", 1)`, "format: missing argument for %s"},
+		{`upper(s = "a")`, "upper does not take named arguments"},
+		{`base64Decode("a")`, `base64Decode: invalid base64 "a"`},
+		{`hexDecode("ff")`, "hexDecode: decoded bytes are not UTF-8 text"},
+		{`sha256({f: upper})`, "field f is a function, which cannot be output"},
+		{`uuidv5("web", "a")`, `uuidv5: invalid namespace "web"`},
+		{`matches("a", "(a")`, `matches: invalid regex "(a": missing closing )`},
+		{`matches("a", 1)`, "argument pattern of matches must be regex or string, got number"},
+		{`error("bad input")`, "Error: bad input - line 1 column 6"},
+	})
+}
+
+func TestEvalMerge(t *testing.T) {
+	testEvalString(t, []struct {
+		input    string
+		expected string
+	}{
+		{`{a: 1, b: 2} + {b: 3, c: 4}`, `{"a":1, "b":3, "c":4}`},
+		{`{db: {host: "a", port: 1}} + {db: {port: 2}}`, `{"db":{"host":"a", "port":2}}`},
+		{`{db: {host: "a", port: 1}} + {db!: {port: 2}}`, `{"db":{"port":2}}`},
+		{`{ports: [80]} + {ports: [443]}`, `{"ports":[443]}`},
+		{`{ports: [80]} + {ports+: [443]}`, `{"ports":[80, 443]}`},
+		{`{a: {ports: [80]}} + {a: {ports+: [443]}}`, `{"a":{"ports":[80, 443]}}`},
+		{`{ports+: [443]}`, `{"ports":[443]}`},
+		{`{base: {a: 1, b: {c: 2}}, x: {...base, b: {d: 3}}}.x`, `{"a":1, "b":{"c":2, "d":3}}`},
+		{`{base: {a: 1, b: 2}, x: {b: 3, ...base}}.x`, `{"b":2, "a":1}`},
+		{`{base: {a: 1}, over: {a: 2}, x: {...base, ...over, c: 3}}.x`, `{"a":2, "c":3}`},
+		{`{a: 1} + {b: 2} + {a: 3}`, `{"a":3, "b":2}`},
+		{`{base: [1, 2], x: [0, ...base, ...[], 3]}.x`, `[0, 1, 2, 3]`},
+		{`[...[for x in [1, 2]: x * 2], ...["a"]]`, `[2, 4, "a"]`},
+	})
+
+	testEvalError(t, []struct {
+		input    string
+		expected string
+	}{
+		{`{a: 1} + 1`, "unknown operator: object + number"},
+		{`{a: 1} + {a+: true}`, "unknown operator: number + boolean"},
+		{`{...[1]}`, "cannot spread array into an object"},
+		{`[...{a: 1}]`, "cannot spread object into an array - line 1 column 2"},
+	})
+}
+
+func TestEvalEnv(t *testing.T) {
+	tests := []struct {
+		input    string
+		options  []Option
+		expected string
+	}{
+		{`env("REGION")`, []Option{WithEnv(map[string]string{"REGION": "eu-west-1"})}, `"eu-west-1"`},
+		{`env("REGION", "us-east-1")`, []Option{WithEnv(map[string]string{})}, `"us-east-1"`},
+		{`env("REPLICAS", "2")`, []Option{WithEnv(map[string]string{})}, `"2"`},
+		{`env("REGION", "x")`, []Option{WithEnv(map[string]string{"REGION": "a"}), WithEnvAllowlist("REGION")}, `"a"`},
+		{`env("YNT_TEST_VARIABLE")`, nil, `"from process"`},
+	}
+
+	t.Setenv("YNT_TEST_VARIABLE", "from process")
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		document := parser.New(l).ParseDocument()
+
+		evaluated, err := New(tt.options...).EvalDocument(document)
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", tt.input, err)
+			continue
+		}
+		if evaluated.String() != tt.expected {
+			t.Errorf("%q: expected=%q, got=%q", tt.input, tt.expected, evaluated.String())
+		}
+	}
+}
+
+func TestEvalEnvErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		options  []Option
+		expected string
+	}{
+		{`env("REGION")`, []Option{WithEnv(map[string]string{})}, "environment variable REGION is not set - line 1 column 4"},
+		{`env("SECRET", "x")`, []Option{WithEnv(map[string]string{"SECRET": "s"}), WithEnvAllowlist("REGION")},
+			"environment variable SECRET is not allowed"},
+		{`env("REGION", "x")`, []Option{WithEnv(map[string]string{"REGION": "a"}), WithEnvAllowlist()},
+			"environment variable REGION is not allowed"},
+		{`env("A", "1", "2")`, nil, "wrong number of arguments to env: got 3"},
+		{`env("A", 1)`, []Option{WithEnv(map[string]string{})}, "argument default of env must be string, got number"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		document := parser.New(l).ParseDocument()
+
+		_, err := New(tt.options...).EvalDocument(document)
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("%q: expected error containing %q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestEvalConstraints(t *testing.T) {
+	testEvalString(t, []struct {
+		input    string
+		expected string
+	}{
+		{`{port: int & >=1 & <=65535 & 8080}`, `{"port":8080}`},
+		{`{port: int & >=1 & <=65535 | *8080}`, `{"port":8080}`},
+		{`{level: "debug" | *"info" | "warn"}`, `{"level":"info"}`},
+		{`{port: int & >=1 | *80} + {port: 443}`, `{"port":443}`},
+		{`{level: "debug" | "info"} + {level: "debug"}`, `{"level":"debug"}`},
+		{`{port: int & >=1 & 8080, url: "host:" + format("%d", port)}.url`, `"host:8080"`},
+		{`{schema: {port: int & >=1, name: string}, x: schema + {port: 80, name: "web"}}.x`,
+			`{"port":80, "name":"web"}`},
+		{`{a: {port: 80}} + {a: {port: int & <100}}`, `{"a":{"port":80}}`},
+		{`{name: !="" & string & "web"}`, `{"name":"web"}`},
+		{`[int & 3]`, `[3]`},
+		{`1 & 1`, `1`},
+	})
+}
+
+func TestEvalConstraintErrors(t *testing.T) {
+	testEvalError(t, []struct {
+		input    string
+		expected string
+	}{
+		{`{port: int & >=1 & <=65535 | *8080} + {port: 70000}`,
+			`invalid value 70000 for port: does not satisfy int & >=1 & <=65535 | *8080 - line 1 column 40`},
+		{`{level: "debug" | "info" | *"warn"} + {level: "trace"}`,
+			`invalid value "trace" for level: does not satisfy "debug" | "info" | *"warn"`},
+		{`{port: int & 1.5}`, `invalid value 1.5: does not satisfy int - line 1 column 12`},
+		{`{port: >=1 & 0}`, `invalid value 0: does not satisfy >=1`},
+		{`{port: int & >=1}`, `field port is incomplete: int & >=1 - line 1 column 2`},
+		{`{level: "a" | "b"}`, `field level is incomplete: "a" | "b"`},
+		{`1 & 2`, `conflicting values 1 and 2`},
+		{`{a: *1 | *2}`, `more than one default`},
+		{`{a: *1}`, `default *1 outside of a disjunction`},
+		{`{a: >=true}`, `bound >= must be a number, a string, a duration, a byte size or a timestamp, got boolean`},
+	})
+}
+
+func TestEvalPatterns(t *testing.T) {
+	testEvalString(t, []struct {
+		input    string
+		expected string
+	}{
+		{`{[name=string]: {replicas: 1, host: name + ".svc"}, web: {}, db: {replicas: 3}}`,
+			`{"web":{"replicas":1, "host":"web.svc"}, "db":{"replicas":3, "host":"db.svc"}}`},
+		{`{[string]: {a: {b: 1, c: 2}}, x: {a: {c: 3}}}`, `{"x":{"a":{"b":1, "c":3}}}`},
+		{`{[string]: int & >0 | *1, a: 2, b: 3}`, `{"a":2, "b":3}`},
+		{`{["web" | "api"]: {port: 80}, web: {}, db: {}}`, `{"web":{"port":80}, "db":{}}`},
+		{`{[string]: {r: 1}, a: {}, b: a.r + 1}`, `{"a":{"r":1}, "b":2}`},
+		{`{[string]: {r: 1}, a: 5, h:: {}}`, `{"a":5}`},
+		{`{[string]: {r: 1}, [n=string]: {n: n}, a: {}}`, `{"a":{"r":1, "n":"a"}}`},
+	})
+}
+
+func TestEvalPatternErrors(t *testing.T) {
+	testEvalError(t, []struct {
+		input    string
+		expected string
+	}{
+		{`{[string]: int & >0, cpu: 0}`, "invalid value 0: does not satisfy >0 - line 1 column 22"},
+		{`{[string]: {port: int}, web: {}}`, "field port is incomplete: int"},
+		{`{[n=string]: {x: n + 1}, a: {}}`, "unknown operator: string + number"},
+	})
+}
+
+func TestEvalComputedKeys(t *testing.T) {
+	testEvalString(t, []struct {
+		input    string
+		expected string
+	}{
+		{`{prefix:: "db", [prefix + "_url"]: "postgres://db", [prefix + "_port"]: 5432}`, `{"db_url":"postgres://db", "db_port":5432}`},
+		{`{a: 1, ["b"]: 2, c: 3}`, `{"a":1, "b":2, "c":3}`},
+		{`{debug:: false, [if debug then "trace" else null]: true, level: "info"}`, `{"level":"info"}`},
+		{`{["web"]: {port: 80}, x: web.port}`, `{"web":{"port":80}, "x":80}`},
+		{`{[string]: {r: 1}, [upper("a")]: {}}`, `{"A":{"r":1}}`},
+		{`{a: {b: 1, tags: ["x"]}} + {["a"]: {c: 2, ["tags"]+: ["y"]}}`, `{"a":{"b":1, "tags":["x", "y"], "c":2}}`},
+	})
+}
+
+func TestEvalComputedKeyErrors(t *testing.T) {
+	testEvalError(t, []struct {
+		input    string
+		expected string
+	}{
+		{`{a: 1, ["a"]: 2}`, "duplicate key \"a\" - line 1 column 8"},
+		{`{[1]: 2}`, "object key must be a string, got number - line 1 column 2"},
+		{`{[x]: 2}`, "identifier not found: x"},
+		{`{[string]:: 2}`, "pattern [string] cannot be hidden or have a merge marker - line 1 column 2"},
+	})
+}
+
+func TestEvalHiddenFields(t *testing.T) {
+	testEvalString(t, []struct {
+		input    string
+		expected string
+	}{
+		{`{base:: 8000, web: base + 80}`, `{"web":8080}`},
+		{`{svc:: function(name) {name: name}, web: svc("web")}`, `{"web":{"name":"web"}}`},
+		{`{a: {h:: 1, v: 2}, b: a.h}`, `{"a":{"v":2}, "b":1}`},
+		{`{a:: 1, b: 2} + {a: 3}`, `{"b":2}`},
+		{`{x: {a:: 1, b: 2} + {a: 3}, y: x.a}.y`, `3`},
+		{`keys({a:: 1, b: 2})`, `["b"]`},
+		{`length({a:: 1, b: 2})`, `1`},
+		{`[for k, v in {a:: 1, b: 2}: k]`, `["b"]`},
+		{`{a:: 1, b: 2} == {b: 2}`, `true`},
+		{`{schema:: {port: int}, x: 1}`, `{"x":1}`},
+	})
+
+	testEvalError(t, []struct {
+		input    string
+		expected string
+	}{
+		{`{f: function(a) a}`, "field f is a function, which cannot be output - line 1 column 2"},
+		{`[{a: int}]`, "field a is incomplete: int"},
+	})
+}
+
+func TestEvalAssertions(t *testing.T) {
+	testEvalString(t, []struct {
+		input    string
+		expected string
+	}{
+		{`{replicas: 3, assert replicas >= 2 : "prod needs HA"}`, `{"replicas":3}`},
+		{`{assert true, a: 1}`, `{"a":1}`},
+		{"{replicas: 3}\nassert replicas >= 2 : \"prod needs HA\"", `{"replicas":3}`},
+		{"assert length(\"ab\") == 2\n[1]", `[1]`},
+		{`{a:: 1, assert a == 1}`, `{}`},
+		{`{replicas: 3, assert replicas >= 2 : "prod needs HA"} + {replicas: 5}`, `{"replicas":5}`},
+	})
+
+	testEvalError(t, []struct {
+		input    string
+		expected string
+	}{
+		{`{replicas: 1, assert replicas >= 2 : "prod needs HA"}`, "assertion failed: prod needs HA - line 1 column 15"},
+		{"{replicas: 1}\nassert replicas >= 2 : \"prod needs HA\"", "assertion failed: prod needs HA - line 2 column 1"},
+		{`{a: 1, assert a == 2}`, "assertion failed: (a == 2) - line 1 column 8"},
+		{`{a: 1, assert a == 2 : format("a is %d", a)}`, "assertion failed: a is 1"},
+		{`{a: {b: 1, assert b > 1 : "small b"}}`, "assertion failed: small b - line 1 column 12"},
+		{`{a: 1, assert a}`, "assertion condition must be a boolean, got number"},
+		{`{f: function(n) {assert n > 0 : "n must be positive", v: n}, x: f(0)}`, "assertion failed: n must be positive"},
+		{`{replicas: 3, assert replicas >= 2 : "prod needs HA"} + {replicas: 1}`, "assertion failed: prod needs HA - line 1 column 15"},
+		{`{a: {replicas: 3, assert replicas >= 2 : "small"}} + {a: {replicas: 1}}`, "assertion failed: small"},
+		{`{min:: 2, r: 3, assert r >= min : "few"} + {r: 1}`, "assertion failed: few"},
+	})
+}
+
+func TestEvalTry(t *testing.T) {
+	testEvalString(t, []struct {
+		input    string
+		expected string
+	}{
+		{`try 1 + 1 else 0`, `2`},
+		{`try 1 / 0 else 0`, `0`},
+		{`{a: {x: 1}, b: try a.y else "none"}`, `{"a":{"x":1}, "b":"none"}`},
+		{`try error("bad input") as e else format("caught: %s", e)`, `"caught: bad input"`},
+		{`try upper(1) as e else e`, `"argument s of upper must be string, got number"`},
+		{`try (try 1 / 0 else error("inner")) as e else e`, `"inner"`},
+		{`{check:: function(n) if n >= 0 then n else error(format("negative: %d", n)), a: try check(-1) as e else e}`, `{"a":"negative: -1"}`},
+		{`try {a: 1, assert a > 1 : "small a"} as e else e`, `"assertion failed: small a"`},
+	})
+}
+
+func TestEvalTryErrors(t *testing.T) {
+	testEvalError(t, []struct {
+		input    string
+		expected string
+	}{
+		{`try 1 / 0 else error("no fallback")`, "no fallback - line 1 column 21"},
+		{`{a: try 1 / 0 as e else 1, b: e}`, "identifier not found: e"},
+		{`{f: function(n) f(n + 1), x: try f(0) else 0}`, "maximum call depth"},
+	})
+}
@@ -0,0 +1,94 @@
+package evaluator
+
+import (
+	"fmt"
+
+	"github.com/salleaffaire/ynt/ast"
+	"github.com/salleaffaire/ynt/lexer"
+	"github.com/salleaffaire/ynt/parser"
+	"github.com/salleaffaire/ynt/token"
+)
+
+// external is an argument passed to the evaluation, either a string or JSON+
+// code.
+type external struct {
+	value string
+	code  bool
+}
+
+// WithExtVar binds name to the string value in every evaluated file.
+func WithExtVar(name, value string) Option {
+	return func(e *Evaluator) {
+		e.setExternal(name, external{value: value})
+	}
+}
+
+// WithExtCode binds name in every evaluated file to the value of code, a
+// JSON+ expression that can only refer to the built-in functions.
+func WithExtCode(name, code string) Option {
+	return func(e *Evaluator) {
+		e.setExternal(name, external{value: code, code: true})
+	}
+}
+
+func (e *Evaluator) setExternal(name string, ext external) {
+	if e.externals == nil {
+		e.externals = make(map[string]external)
+	}
+	e.externals[name] = ext
+}
+
+// externalEnv returns the environment binding the external arguments, which
+// encloses the built-in functions.
+func (e *Evaluator) externalEnv() (*Environment, error) {
+	env := NewEnclosedEnvironment(builtinEnv)
+
+	for name, ext := range e.externals {
+		if !ext.code {
+			env.Set(name, newString(token.Token{Type: token.STRING}, ext.value))
+			continue
+		}
+
+		l, err := lexer.Tokenize(ext.value)
+		if err != nil {
+			return nil, wrapCause(err, "Error: cannot parse external argument %s", name)
+		}
+		document, err := parser.New(l).ParseContext(e.ctx)
+		if err != nil {
+			return nil, wrapCause(err, "Error: cannot parse external argument %s", name)
+		}
+		if len(document.Values) != 1 || len(document.Params) > 0 || len(document.Assertions) > 0 {
+			return nil, fmt.Errorf("Error: external argument %s must be a single value", name)
+		}
+
+		v, err := e.Eval(document.Values[0], builtinEnv)
+		if err != nil {
+			return nil, wrapCause(err, "Error: cannot evaluate external argument %s", name)
+		}
+		env.Set(name, v)
+	}
+
+	return env, nil
+}
+
+// bindParams checks that the external arguments declared by params are given,
+// and binds those which are not to their default in env.
+func (e *Evaluator) bindParams(params []*ast.Parameter, env *Environment) error {
+	declared := make(map[string]bool)
+	for _, param := range params {
+		name := param.Name.Value
+		if declared[name] {
+			return newError(param.Name.Token, "duplicate param %s", name)
+		}
+		declared[name] = true
+
+		if _, ok := e.extEnv.store[name]; ok {
+			continue
+		}
+		if param.Default == nil {
+			return newError(param.Name.Token, "missing external argument %s", name)
+		}
+		env.setLazy(name, param.Default, newFieldEnvironment(env, name))
+	}
+	return nil
+}
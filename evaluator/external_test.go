@@ -0,0 +1,68 @@
+package evaluator
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExternalArguments(t *testing.T) {
+	input := `param env
+param replicas = 1
+param name = "web-" + env
+{name: name, env: env, replicas: replicas}`
+
+	tests := []struct {
+		options  []Option
+		expected string
+	}{
+		{[]Option{WithExtVar("env", "dev")}, `{"name":"web-dev", "env":"dev", "replicas":1}`},
+		{[]Option{WithExtVar("env", "prod"), WithExtCode("replicas", "1 + 2")}, `{"name":"web-prod", "env":"prod", "replicas":3}`},
+		{[]Option{WithExtVar("env", "prod"), WithExtVar("name", "api")}, `{"name":"api", "env":"prod", "replicas":1}`},
+		{[]Option{WithExtCode("env", `upper("qa")`), WithExtCode("replicas", "max(2, 1)")}, `{"name":"web-QA", "env":"QA", "replicas":2}`},
+	}
+
+	for _, tt := range tests {
+		evaluated, err := New(tt.options...).EvalDocument(parse(t, input))
+		if err != nil {
+			t.Errorf("unexpected error %v", err)
+			continue
+		}
+		if evaluated.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, evaluated.String())
+		}
+	}
+
+	// Undeclared arguments are visible too
+	evaluated, err := New(WithExtVar("region", "eu")).EvalDocument(parse(t, `{region: region}`))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if evaluated.String() != `{"region":"eu"}` {
+		t.Errorf("expected=%q, got=%q", `{"region":"eu"}`, evaluated.String())
+	}
+}
+
+func TestExternalArgumentErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		options  []Option
+		expected string
+	}{
+		{"param env\n{env: env}", nil, "missing external argument env - line 1 column 7"},
+		{"param env\nparam env\n{env: env}", []Option{WithExtVar("env", "dev")}, "duplicate param env - line 2 column 7"},
+		{"{}", []Option{WithExtCode("n", "1 +")}, "cannot parse external argument n"},
+		{"{}", []Option{WithExtCode("n", "1 2")}, "external argument n must be a single value"},
+		{"{}", []Option{WithExtCode("n", "x")}, "cannot evaluate external argument n"},
+	}
+
+	for _, tt := range tests {
+		_, err := New(tt.options...).EvalDocument(parse(t, tt.input))
+		if err == nil {
+			t.Errorf("%q: expected an error", tt.input)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("%q: expected error containing %q, got=%q", tt.input, tt.expected, err.Error())
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package evaluator
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/salleaffaire/ynt/ast"
+	"github.com/salleaffaire/ynt/lexer"
+	"github.com/salleaffaire/ynt/parser"
+	"github.com/salleaffaire/ynt/token"
+)
+
+func (e *Evaluator) evalImportExpression(ie *ast.ImportExpression, env *Environment) (ast.Value, error) {
+	name, err := e.resolveImport(ie.Path.Token, env.file, ie.Path.Value)
+	if err != nil {
+		return nil, err
+	}
+	return e.importFile(ie.Token, name)
+}
+
+// resolveImport returns the name in the evaluator file system of the file
+// imported as p from the file importer. p is looked for relative to the
+// directory of importer, then in each directory of the search path. A path
+// without an extension also names the file with the .ynt extension.
+func (e *Evaluator) resolveImport(tok token.Token, importer string, p string) (string, error) {
+	if e.fsys == nil {
+		return "", newError(tok, "cannot import %q: no file system", p)
+	}
+
+	dirs := []string{"/"}
+	if !path.IsAbs(p) {
+		dirs = append([]string{path.Dir(importer)}, e.searchPath...)
+	}
+	names := []string{p}
+	if path.Ext(p) == "" {
+		names = append(names, p+".ynt")
+	}
+
+	for _, dir := range dirs {
+		for _, n := range names {
+			name := strings.TrimPrefix(path.Join(dir, n), "/")
+			if info, err := fs.Stat(e.fsys, name); err == nil && !info.IsDir() {
+				return name, nil
+			}
+		}
+	}
+
+	shown := make([]string, len(dirs))
+	for i, dir := range dirs {
+		shown[i] = e.fileName(dir)
+	}
+	return "", newError(tok, "cannot find import %q in %s", p, strings.Join(shown, ", "))
+}
+
+// bindImports binds the names of the imports of a document in env. Files are
+// imported when their name is first used.
+func (e *Evaluator) bindImports(imports []*ast.Import, env *Environment) error {
+	declared := make(map[string]bool)
+	for _, im := range imports {
+		name := im.Name.Value
+		if declared[name] {
+			return newError(im.Name.Token, "duplicate import %s", name)
+		}
+		declared[name] = true
+		env.setLazy(name, &ast.ImportExpression{Token: im.Token, Path: im.Path}, env)
+	}
+	return nil
+}
+
+// export returns the fields of v, the value of a document, that the document
+// exports. Every field is exported when the document declares no export.
+func export(exports []*ast.Identifier, v ast.Value) (ast.Value, error) {
+	if len(exports) == 0 {
+		return v, nil
+	}
+	ov, ok := v.(*ast.ObjectValue)
+	if !ok {
+		return nil, newError(exports[0].Token, "cannot export fields of %s", typeName(v))
+	}
+
+	result := &ast.ObjectValue{Token: ov.Token, Attributes: []ast.Attribute{}}
+	for _, ex := range exports {
+		i := attributeIndex(ov, ex.Value)
+		if i < 0 {
+			return nil, newError(ex.Token, "cannot export %s: field not found", ex.Value)
+		}
+		if attributeIndex(result, ex.Value) < 0 {
+			result.Attributes = append(result.Attributes, ov.Attributes[i])
+		}
+	}
+	return result, nil
+}
+
+// importFile returns the value of the file name. Each file is evaluated once
+// per evaluation, and a file that imports itself, directly or not, is an
+// error.
+func (e *Evaluator) importFile(tok token.Token, name string) (ast.Value, error) {
+	if v, ok := e.imports[name]; ok {
+		return v, nil
+	}
+
+	for i, f := range e.importing {
+		if f == name {
+			chain := []string{}
+			for _, f := range append(append([]string{}, e.importing[i:]...), name) {
+				chain = append(chain, e.fileName(f))
+			}
+			return nil, newError(tok, "import cycle: %s", strings.Join(chain, " -> "))
+		}
+	}
+
+	document, err := e.loadFile(name)
+	if err != nil {
+		return nil, wrapError(tok, err)
+	}
+
+	e.importing = append(e.importing, name)
+	v, err := e.evalDocument(document, name, true)
+	e.importing = e.importing[:len(e.importing)-1]
+	if err != nil {
+		return nil, err
+	}
+
+	e.imports[name] = v
+	return v, nil
+}
+
+// loadFile reads and parses the file name.
+func (e *Evaluator) loadFile(name string) (*ast.Document, error) {
+	if e.fsys == nil {
+		return nil, fmt.Errorf("cannot read %s: no file system", e.fileName(name))
+	}
+
+	src, err := fs.ReadFile(e.fsys, name)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read %s: %w", e.fileName(name), err)
+	}
+
+	l, err := lexer.Tokenize(string(src))
+	if err != nil {
+		return nil, wrapCause(err, "cannot parse %s", e.fileName(name))
+	}
+	document, err := parser.New(l).ParseContext(e.ctx)
+	if err != nil {
+		return nil, wrapCause(err, "cannot parse %s", e.fileName(name))
+	}
+
+	return document, nil
+}
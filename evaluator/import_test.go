@@ -0,0 +1,237 @@
+package evaluator
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// countingFS counts the files read from it.
+type countingFS struct {
+	fstest.MapFS
+	reads map[string]int
+}
+
+func (c *countingFS) ReadFile(name string) ([]byte, error) {
+	c.reads[name]++
+	return c.MapFS.ReadFile(name)
+}
+
+func file(src string) *fstest.MapFile {
+	return &fstest.MapFile{Data: []byte(src)}
+}
+
+func TestImport(t *testing.T) {
+	fsys := &countingFS{
+		MapFS: fstest.MapFS{
+			"main.ynt":         file(`{common: import "lib/common.ynt", again: import "lib/common.ynt", port: common.port}`),
+			"lib/common.ynt":   file(`{port: (import "defaults.ynt").port + 1}`),
+			"lib/defaults.ynt": file(`{port: 8080}`),
+		},
+		reads: map[string]int{},
+	}
+
+	evaluated, err := New(WithFS(fsys)).EvalFile("main.ynt")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	expected := `{"common":{"port":8081}, "again":{"port":8081}, "port":8081}`
+	if evaluated.String() != expected {
+		t.Errorf("expected=%q, got=%q", expected, evaluated.String())
+	}
+
+	for name, n := range fsys.reads {
+		if n != 1 {
+			t.Errorf("%s read %d times", name, n)
+		}
+	}
+}
+
+func TestImportSearchPath(t *testing.T) {
+	fsys := fstest.MapFS{
+		"app/main.ynt":      file(`import "k8s.ynt"`),
+		"vendor/k8s.ynt":    file(`"vendored"`),
+		"shared/k8s.ynt":    file(`"shared"`),
+		"app/local.ynt":     file(`import "/shared/k8s.ynt"`),
+		"app/relative.ynt":  file(`import "k8s.ynt"`),
+		"app/k8s.ynt":       file(`"local"`),
+		"other/missing.ynt": file(`import "nowhere.ynt"`),
+	}
+
+	tests := []struct {
+		file     string
+		expected string
+	}{
+		{"app/main.ynt", `"local"`},
+		{"app/local.ynt", `"shared"`},
+	}
+
+	for _, tt := range tests {
+		evaluated, err := New(WithFS(fsys), WithSearchPath("vendor")).EvalFile(tt.file)
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", tt.file, err)
+		}
+		if evaluated.String() != tt.expected {
+			t.Errorf("%s: expected=%q, got=%q", tt.file, tt.expected, evaluated.String())
+		}
+	}
+
+	delete(fsys, "app/k8s.ynt")
+	evaluated, err := New(WithFS(fsys), WithSearchPath("vendor", "shared")).EvalFile("app/main.ynt")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if evaluated.String() != `"vendored"` {
+		t.Errorf("expected=%q, got=%q", `"vendored"`, evaluated.String())
+	}
+
+	_, err = New(WithFS(fsys), WithSearchPath("vendor")).EvalFile("other/missing.ynt")
+	expected := `cannot find import "nowhere.ynt" in other, vendor`
+	if err == nil || !strings.Contains(err.Error(), expected) {
+		t.Errorf("expected error containing %q, got=%v", expected, err)
+	}
+}
+
+func TestImportModules(t *testing.T) {
+	fsys := fstest.MapFS{
+		"lib/k8s.ynt": file(`import "labels" as labels
+export deployment
+{
+  prefix: "app-",
+  deployment:: function(n) {kind: "Deployment", name: prefix + n, labels: labels.of(n)}
+}`),
+		"lib/labels.ynt": file(`{of:: function(name) {app: name}}`),
+		"app/main.ynt": file(`import "lib/k8s" as k8s
+{web: k8s.deployment("web")}`),
+		"app/private.ynt": file(`import "lib/k8s" as k8s
+{p: k8s.prefix}`),
+		"app/merge.ynt": file(`import "lib/labels" + {extra: 1}`),
+	}
+
+	tests := []struct {
+		file     string
+		expected string
+	}{
+		{"app/main.ynt", `{"web":{"kind":"Deployment", "name":"app-web", "labels":{"app":"web"}}}`},
+		{"app/merge.ynt", `{"extra":1}`},
+		// A file's exports do not apply when it is evaluated itself
+		{"lib/k8s.ynt", `{"prefix":"app-"}`},
+	}
+
+	for _, tt := range tests {
+		evaluated, err := New(WithFS(fsys), WithSearchPath("vendor", ".")).EvalFile(tt.file)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tt.file, err)
+			continue
+		}
+		if evaluated.String() != tt.expected {
+			t.Errorf("%s: expected=%q, got=%q", tt.file, tt.expected, evaluated.String())
+		}
+	}
+
+	_, err := New(WithFS(fsys), WithSearchPath(".")).EvalFile("app/private.ynt")
+	expected := "Error: field prefix not found - app/private.ynt line 2 column 9"
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected=%q, got=%v", expected, err)
+	}
+	_, err = New(WithFS(fsys), WithSearchPath("vendor")).EvalFile("app/main.ynt")
+	expected = `Error: cannot find import "lib/k8s" in app, vendor - app/main.ynt line 1 column 8`
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected=%q, got=%v", expected, err)
+	}
+}
+
+func TestImportExportsFromDocument(t *testing.T) {
+	fsys := fstest.MapFS{
+		"pub.ynt": file("export pub\n{pub: 1, priv: 2}"),
+	}
+
+	evaluated, err := New(WithFS(fsys)).EvalDocument(parse(t, `import "pub.ynt"`))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if evaluated.String() != `{"pub":1}` {
+		t.Errorf("expected=%q, got=%q", `{"pub":1}`, evaluated.String())
+	}
+}
+
+func TestImportErrors(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.ynt":       file(`{b: import "b.ynt"}`),
+		"b.ynt":       file(`{c: import "c.ynt"}`),
+		"c.ynt":       file(`{a: import "a.ynt"}`),
+		"bad.ynt":     file(`{a: }`),
+		"lib.ynt":     file("{\n  div: function(n) n / 0\n}"),
+		"caller.ynt":  file("{\n  lib: import \"lib.ynt\",\n  x: lib.div(1)\n}"),
+		"parse.ynt":   file(`import "bad.ynt"`),
+		"dup.ynt":     file("import \"lib.ynt\" as lib\nimport \"b.ynt\" as lib\n{}"),
+		"exports.ynt": file("export a, nope\n{a: 1}"),
+		"user.ynt":    file(`import "exports.ynt"`),
+	}
+
+	tests := []struct {
+		file     string
+		expected string
+	}{
+		{"a.ynt", "Error: import cycle: a.ynt -> b.ynt -> c.ynt -> a.ynt - c.ynt line 1 column 5"},
+		{"parse.ynt", "cannot parse bad.ynt: unexpected token } - line 1 column 5"},
+		{"caller.ynt", "Error: division by zero - lib.ynt line 2 column 22\n\tat lib.div - caller.ynt line 3 column 13"},
+		{"missing.ynt", "cannot read missing.ynt"},
+		{"dup.ynt", "Error: duplicate import lib - dup.ynt line 2 column 19"},
+		{"user.ynt", "Error: cannot export nope: field not found - exports.ynt line 1 column 11"},
+	}
+
+	for _, tt := range tests {
+		_, err := New(WithFS(fsys)).EvalFile(tt.file)
+		if err == nil {
+			t.Errorf("%s: expected an error", tt.file)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("%s: expected error containing %q, got=%q", tt.file, tt.expected, err.Error())
+		}
+	}
+
+	_, err := New().EvalFile("a.ynt")
+	if err == nil || !strings.Contains(err.Error(), "no file system") {
+		t.Errorf("expected a no file system error, got=%v", err)
+	}
+}
+
+func TestImportFileNames(t *testing.T) {
+	fsys := fstest.MapFS{
+		"srv/a.ynt":       file(`{b: import "b.ynt"}`),
+		"srv/b.ynt":       file(`{a: import "a.ynt"}`),
+		"srv/caller.ynt":  file("{\n  lib: import \"lib.ynt\",\n  x: lib.div(1)\n}"),
+		"srv/lib.ynt":     file("{\n  div: function(n) n / 0\n}"),
+		"srv/missing.ynt": file(`import "nowhere.ynt"`),
+		"srv/parse.ynt":   file(`import "bad.ynt"`),
+		"srv/bad.ynt":     file(`{a: }`),
+	}
+	names := func(name string) string {
+		return "/" + name
+	}
+
+	tests := []struct {
+		file     string
+		expected string
+	}{
+		{"srv/a.ynt", "Error: import cycle: /srv/a.ynt -> /srv/b.ynt -> /srv/a.ynt - /srv/b.ynt line 1 column 5"},
+		{"srv/caller.ynt", "Error: division by zero - /srv/lib.ynt line 2 column 22\n\tat lib.div - /srv/caller.ynt line 3 column 13"},
+		{"srv/missing.ynt", `Error: cannot find import "nowhere.ynt" in /srv, /vendor - /srv/missing.ynt line 1 column 8`},
+		{"srv/parse.ynt", "cannot parse /srv/bad.ynt: unexpected token } - line 1 column 5"},
+		{"srv/none.ynt", "cannot read /srv/none.ynt"},
+	}
+
+	for _, tt := range tests {
+		_, err := New(WithFS(fsys), WithSearchPath("vendor"), WithFileNames(names)).EvalFile(tt.file)
+		if err == nil {
+			t.Errorf("%s: expected an error", tt.file)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("%s: expected error containing %q, got=%q", tt.file, tt.expected, err.Error())
+		}
+	}
+}
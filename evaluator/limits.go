@@ -0,0 +1,100 @@
+package evaluator
+
+import (
+	"fmt"
+
+	"github.com/salleaffaire/ynt/ast"
+	"github.com/salleaffaire/ynt/token"
+)
+
+// StepLimitError is the cause of an Error when evaluation takes more steps
+// than allowed by WithMaxSteps.
+type StepLimitError struct {
+	Limit int
+}
+
+func (e *StepLimitError) Error() string {
+	return fmt.Sprintf("maximum of %d evaluation steps exceeded", e.Limit)
+}
+
+// DepthLimitError is the cause of an Error when function calls nest deeper
+// than allowed by WithMaxDepth.
+type DepthLimitError struct {
+	Limit int
+}
+
+func (e *DepthLimitError) Error() string {
+	return fmt.Sprintf("maximum call depth of %d exceeded", e.Limit)
+}
+
+// OutputLimitError is the cause of an Error when the result is larger than
+// allowed by WithMaxOutput.
+type OutputLimitError struct {
+	Limit int
+}
+
+func (e *OutputLimitError) Error() string {
+	return fmt.Sprintf("output exceeds the maximum of %d bytes", e.Limit)
+}
+
+// WithMaxSteps makes evaluation fail with a StepLimitError after n steps. A
+// step is a function call or an iteration of a comprehension or of range.
+// There is no limit when n is 0.
+func WithMaxSteps(n int) Option {
+	return func(e *Evaluator) {
+		e.maxSteps = n
+	}
+}
+
+// WithMaxDepth makes evaluation fail with a DepthLimitError when more than n
+// function calls are nested. It defaults to DefaultMaxDepth.
+func WithMaxDepth(n int) Option {
+	return func(e *Evaluator) {
+		e.maxDepth = n
+	}
+}
+
+// WithMaxOutput makes evaluation fail with an OutputLimitError when the
+// result is more than n bytes long once output. There is no limit when n is 0.
+func WithMaxOutput(n int) Option {
+	return func(e *Evaluator) {
+		e.maxOutput = n
+	}
+}
+
+// step counts a step of the evaluation at tok, and fails when there are too
+// many or when the context of the evaluation is done.
+func (e *Evaluator) step(tok token.Token) error {
+	e.steps++
+	if e.maxSteps > 0 && e.steps > e.maxSteps {
+		return wrapError(tok, &StepLimitError{Limit: e.maxSteps})
+	}
+
+	select {
+	case <-e.ctx.Done():
+		return wrapError(tok, e.ctx.Err())
+	default:
+	}
+
+	return nil
+}
+
+// output returns v as it is output, and fails as soon as it is longer than
+// allowed.
+func (e *Evaluator) output(v ast.Value) (ast.Value, error) {
+	e.outputSize = 0
+	return e.manifest(v)
+}
+
+// count adds n bytes of output at tok, and fails when the output is then
+// longer than allowed.
+func (e *Evaluator) count(tok token.Token, n int) error {
+	if e.maxOutput == 0 {
+		return nil
+	}
+	e.outputSize += n
+	if e.outputSize > e.maxOutput {
+		return wrapError(tok, &OutputLimitError{Limit: e.maxOutput})
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package evaluator
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/salleaffaire/ynt/ast"
+	"github.com/salleaffaire/ynt/lexer"
+	"github.com/salleaffaire/ynt/parser"
+)
+
+func parse(t *testing.T, input string) *ast.Document {
+	t.Helper()
+
+	l, err := lexer.Tokenize(input)
+	if err != nil {
+		t.Fatalf("lexer failed on %q: %v", input, err)
+	}
+	document, err := parser.New(l).Parse()
+	if err != nil {
+		t.Fatalf("parser failed on %q: %v", input, err)
+	}
+	return document
+}
+
+func TestLimits(t *testing.T) {
+	var steps *StepLimitError
+	var depth *DepthLimitError
+	var output *OutputLimitError
+
+	tests := []struct {
+		input    string
+		option   Option
+		target   interface{}
+		expected string
+	}{
+		{`[for x in range(0, 1000): x]`, WithMaxSteps(100), &steps, "maximum of 100 evaluation steps exceeded - line 1 column 16"},
+		{`{f: function(n) if n == 0 then 0 else f(n - 1) + f(n - 1), x: f(20)}`, WithMaxSteps(1000), &steps, "maximum of 1000 evaluation steps exceeded"},
+		{`{f: function(n) f(n + 1), x: f(0)}`, WithMaxDepth(10), &depth, "maximum call depth of 10 exceeded"},
+		{`try [for x in range(0, 1000): x] else []`, WithMaxSteps(100), &steps, "maximum of 100 evaluation steps exceeded"},
+		{`{f: function(n) f(n + 1), x: try f(0) else 0}`, WithMaxDepth(10), &depth, "maximum call depth of 10 exceeded"},
+		{`{a: "0123456789"}`, WithMaxOutput(10), &output, "output exceeds the maximum of 10 bytes - line 1 column 5"},
+		{`{a: [for x in range(0, 3): x]}`, WithMaxOutput(14), &output, "output exceeds the maximum of 14 bytes"},
+		{`[for x in range(0, 10000): {name: "web", port: x}]`, WithMaxOutput(100), &output, "output exceeds the maximum of 100 bytes - line 1 column 42"},
+	}
+
+	for _, tt := range tests {
+		_, err := New(tt.option).EvalDocument(parse(t, tt.input))
+		if err == nil {
+			t.Errorf("%q: expected an error", tt.input)
+			continue
+		}
+		if !errors.As(err, tt.target) {
+			t.Errorf("%q: expected error of type %T, got=%T", tt.input, tt.target, err)
+		}
+		if !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("%q: expected error containing %q, got=%q", tt.input, tt.expected, err.Error())
+		}
+	}
+
+	evaluated, err := New(WithMaxSteps(100), WithMaxOutput(15)).EvalDocument(parse(t, `{a: [for x in range(0, 3): x]}`))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if evaluated.String() != `{"a":[0, 1, 2]}` {
+		t.Errorf("expected=%q, got=%q", `{"a":[0, 1, 2]}`, evaluated.String())
+	}
+}
+
+func TestContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := New().EvalDocumentContext(ctx, parse(t, `[for x in [1, 2]: x]`))
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected a canceled error, got=%v", err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	input := `{f: function(n) if n == 0 then 0 else f(n - 1) + f(n - 1), x: f(100)}`
+	_, err = New().EvalDocumentContext(ctx, parse(t, input))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected a deadline error, got=%v", err)
+	}
+}
+
+// cancelFS is a file system canceling an evaluation when the file name is
+// opened.
+type cancelFS struct {
+	fsys   fstest.MapFS
+	name   string
+	cancel context.CancelFunc
+}
+
+func (c cancelFS) Open(name string) (fs.File, error) {
+	if name == c.name {
+		c.cancel()
+	}
+	return c.fsys.Open(name)
+}
+
+func TestContextImport(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fsys := cancelFS{
+		fsys: fstest.MapFS{
+			"main.ynt": file(`{x: import "b.ynt"}`),
+			"b.ynt":    file(`{y: 1}`),
+		},
+		name:   "b.ynt",
+		cancel: cancel,
+	}
+
+	_, err := New(WithFS(fsys)).EvalFileContext(ctx, "main.ynt")
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected a canceled error, got=%v", err)
+	}
+	expected := "Error: cannot parse b.ynt: parsing stopped: context canceled - main.ynt line 1 column 5"
+	if err.Error() != expected {
+		t.Errorf("expected=%q, got=%q", expected, err.Error())
+	}
+}
+
+func TestContextTryImport(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fsys := cancelFS{
+		fsys: fstest.MapFS{
+			"main.ynt": file(`{x: try import "b.ynt" else "fallback"}`),
+			"b.ynt":    file(`{y: 1}`),
+		},
+		name:   "b.ynt",
+		cancel: cancel,
+	}
+
+	_, err := New(WithFS(fsys)).EvalFileContext(ctx, "main.ynt")
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected a canceled error, got=%v", err)
+	}
+}
@@ -0,0 +1,118 @@
+package evaluator
+
+import (
+	"github.com/salleaffaire/ynt/ast"
+	"github.com/salleaffaire/ynt/token"
+)
+
+// manifest returns v as it is output. Hidden fields are left out, durations,
+// byte sizes, timestamps and regexes are encoded, and it is an error for what remains
+// to hold a function or a constraint without a value.
+func (e *Evaluator) manifest(v ast.Value) (ast.Value, error) {
+	switch v := v.(type) {
+	case *ast.ObjectValue:
+		result := &ast.ObjectValue{Token: v.Token, Attributes: []ast.Attribute{}}
+		if err := e.count(v.Token, len("{}")); err != nil {
+			return nil, err
+		}
+		for i, att := range visibleAttributes(v) {
+			if err := checkManifestable(att.Token, "field "+att.Key, att.V); err != nil {
+				return nil, err
+			}
+			n := len(ast.Escape(att.Key)) + len(`"":`)
+			if i > 0 {
+				n += len(", ")
+			}
+			if err := e.count(att.Token, n); err != nil {
+				return nil, err
+			}
+			mv, err := e.manifest(att.V)
+			if err != nil {
+				return nil, err
+			}
+			result.Attributes = append(result.Attributes, ast.Attribute{Token: att.Token, Key: att.Key, V: mv})
+		}
+		return result, nil
+
+	case *ast.ArrayValue:
+		result := &ast.ArrayValue{Token: v.Token, Values: []ast.Value{}}
+		if err := e.count(v.Token, len("[]")); err != nil {
+			return nil, err
+		}
+		for i, elem := range v.Values {
+			if err := checkManifestable(v.Token, "array element", elem); err != nil {
+				return nil, err
+			}
+			if i > 0 {
+				if err := e.count(v.Token, len(", ")); err != nil {
+					return nil, err
+				}
+			}
+			me, err := e.manifest(elem)
+			if err != nil {
+				return nil, err
+			}
+			result.Values = append(result.Values, me)
+		}
+		return result, nil
+	}
+
+	if err := checkManifestable(valueToken(v), "value", v); err != nil {
+		return nil, err
+	}
+	ev, err := e.encode(v)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.count(valueToken(ev), len(ev.String())); err != nil {
+		return nil, err
+	}
+	return ev, nil
+}
+
+// checkManifestable returns an error when v cannot be output. what describes v
+// in the message.
+func checkManifestable(tok token.Token, what string, v ast.Value) error {
+	if isConstraint(v) {
+		return newError(tok, "%s is incomplete: %s", what, show(v))
+	}
+	if typeName(v) == "function" {
+		return newError(tok, "%s is a function, which cannot be output", what)
+	}
+	return nil
+}
+
+// valueToken returns the token of the values that are output as they are or
+// cannot be output.
+func valueToken(v ast.Value) token.Token {
+	switch v := v.(type) {
+	case *ast.NumberValue:
+		return v.Token
+	case *ast.StringValue:
+		return v.Token
+	case *ast.BooleanValue:
+		return v.Token
+	case *ast.NullValue:
+		return v.Token
+	case *Function:
+		return v.Token
+	case *ast.BoundConstraint:
+		return v.Token
+	case *ast.Disjunction:
+		return v.Token
+	case *ast.Conjunction:
+		return v.Token
+	}
+	return token.Token{}
+}
+
+// visibleAttributes returns the attributes of ov that are not hidden.
+func visibleAttributes(ov *ast.ObjectValue) []ast.Attribute {
+	visible := make([]ast.Attribute, 0, len(ov.Attributes))
+	for _, att := range ov.Attributes {
+		if !att.Hidden {
+			visible = append(visible, att)
+		}
+	}
+	return visible
+}
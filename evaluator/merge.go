@@ -0,0 +1,108 @@
+package evaluator
+
+import (
+	"github.com/salleaffaire/ynt/ast"
+	"github.com/salleaffaire/ynt/token"
+)
+
+// merge returns the deep merge of right into left. Keys keep the position of
+// their first appearance, and new keys of right follow those of left in their
+// own order.
+func merge(tok token.Token, left, right *ast.ObjectValue) (*ast.ObjectValue, error) {
+	result := &ast.ObjectValue{Token: left.Token, Attributes: append([]ast.Attribute{}, left.Attributes...)}
+
+	for _, att := range right.Attributes {
+		if err := mergeAttribute(tok, result, att); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// mergeAttribute merges att into the attributes of dst, according to its merge
+// mode. Values from right win, except that objects merge recursively.
+func mergeAttribute(tok token.Token, dst *ast.ObjectValue, att ast.Attribute) error {
+	i := attributeIndex(dst, att.Key)
+	if i < 0 {
+		dst.Attributes = append(dst.Attributes, att)
+		return nil
+	}
+
+	merged := att
+	merged.Merge = ast.MergeDeep
+	merged.Hidden = dst.Attributes[i].Hidden || att.Hidden
+	merged.Constraint = combineConstraints(dst.Attributes[i].Constraint, att.Constraint)
+	old := dst.Attributes[i].V
+
+	// A field that is only a constraint keeps the value it overrides
+	if isConstraint(att.V) && !isConstraint(old) {
+		merged.V = old
+	}
+
+	switch att.Merge {
+	case ast.MergeAppend:
+		v, err := add(att.Token, old, att.V)
+		if err != nil {
+			return err
+		}
+		merged.V = v
+
+	case ast.MergeDeep:
+		l, lok := old.(*ast.ObjectValue)
+		r, rok := att.V.(*ast.ObjectValue)
+		if lok && rok {
+			v, err := merge(tok, l, r)
+			if err != nil {
+				return err
+			}
+			merged.V = v
+		}
+	}
+
+	if merged.Constraint != nil && !isConstraint(merged.V) && !satisfies(merged.Constraint, merged.V) {
+		return newError(att.Token, "invalid value %s for %s: does not satisfy %s",
+			show(merged.V), att.Key, show(merged.Constraint))
+	}
+
+	dst.Attributes[i] = merged
+	return nil
+}
+
+func attributeIndex(ov *ast.ObjectValue, key string) int {
+	for i, att := range ov.Attributes {
+		if att.Key == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// add implements the + operator.
+func add(tok token.Token, left, right ast.Value) (ast.Value, error) {
+	if v, ok := addUnits(tok, left, right); ok {
+		return v, nil
+	}
+
+	switch l := left.(type) {
+	case *ast.NumberValue:
+		if r, ok := right.(*ast.NumberValue); ok {
+			return newNumber(tok, l.Value+r.Value), nil
+		}
+	case *ast.StringValue:
+		if r, ok := right.(*ast.StringValue); ok {
+			return markSecret(newString(tok, l.Value+r.Value), l, r), nil
+		}
+	case *ast.ArrayValue:
+		if r, ok := right.(*ast.ArrayValue); ok {
+			values := append(append([]ast.Value{}, l.Values...), r.Values...)
+			return &ast.ArrayValue{Token: l.Token, Values: values}, nil
+		}
+	case *ast.ObjectValue:
+		if r, ok := right.(*ast.ObjectValue); ok {
+			return merge(tok, l, r)
+		}
+	}
+
+	return nil, newError(tok, "unknown operator: %s + %s", typeName(left), typeName(right))
+}
@@ -0,0 +1,90 @@
+package evaluator
+
+import (
+	"github.com/salleaffaire/ynt/ast"
+)
+
+// bindPatterns makes the patterns of ov apply to the visible fields of its
+// scope whose key they match, when the fields are evaluated. Patterns apply
+// from the last one, so that the fields of the first come first and later
+// patterns take priority.
+func (e *Evaluator) bindPatterns(ov *ast.ObjectValue, scope *Environment) error {
+	constraints := make([]ast.Value, len(ov.Patterns))
+	for i, pa := range ov.Patterns {
+		c, err := e.Eval(pa.Constraint, scope)
+		if err != nil {
+			return err
+		}
+		constraints[i] = c
+	}
+
+	for _, att := range ov.Attributes {
+		if att.Spread || att.Hidden {
+			continue
+		}
+		att := att
+		key := newString(att.Token, att.Key)
+		for i := len(ov.Patterns) - 1; i >= 0; i-- {
+			if !satisfies(constraints[i], key) {
+				continue
+			}
+			pa := ov.Patterns[i]
+			th := scope.store[att.Key]
+			then := th.then
+			th.then = func(v ast.Value) (ast.Value, error) {
+				if then != nil {
+					var err error
+					if v, err = then(v); err != nil {
+						return nil, err
+					}
+				}
+				return e.applyPattern(pa, scope, att, v)
+			}
+		}
+	}
+
+	return nil
+}
+
+// applyPattern merges the value of the pattern pa for the field att into v,
+// the value of the field. Objects merge recursively with the fields of v taking
+// priority, a constraint must be satisfied by v, and other values of v win.
+func (e *Evaluator) applyPattern(pa *ast.Pattern, scope *Environment, att ast.Attribute, v ast.Value) (ast.Value, error) {
+	env := NewEnclosedEnvironment(scope)
+	if pa.Name != nil {
+		env.Set(pa.Name.Value, newString(att.Token, att.Key))
+	}
+	def, err := e.Eval(pa.Value, env)
+	if err != nil {
+		return nil, err
+	}
+
+	if isConstraint(def) {
+		return unify(att.Token, def, v)
+	}
+
+	base, bok := def.(*ast.ObjectValue)
+	overlay, ook := v.(*ast.ObjectValue)
+	if !bok || !ook {
+		return v, nil
+	}
+	merged, err := merge(pa.Token, base, overlay)
+	if err != nil {
+		return nil, err
+	}
+	if e.provenance {
+		name := pa.Constraint.String()
+		if pa.Name != nil {
+			name = pa.Name.Value + "=" + name
+		}
+		step := Step{Kind: StepPattern, Name: "[" + name + "]", File: scope.file, Token: pa.Token}
+		for _, ma := range merged.Attributes {
+			chain := e.chains[overlay][ma.Key]
+			if attributeIndex(overlay, ma.Key) < 0 {
+				chain = append([]Step{step}, e.chains[base][ma.Key]...)
+			}
+			e.setChain(merged, ma.Key, chain)
+		}
+	}
+	return merged, nil
+}
@@ -0,0 +1,129 @@
+package evaluator
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/salleaffaire/ynt/ast"
+)
+
+// WithProfiles selects the profiles whose overlays are merged into the result
+// of the files declaring them. Overlays are merged in the order the profiles
+// are declared, whatever the order they are selected in.
+func WithProfiles(names ...string) Option {
+	return func(e *Evaluator) {
+		e.profiles = append(e.profiles, names...)
+	}
+}
+
+// ProfileSources returns, for each output field of the last evaluation set by
+// a profile, the name of the last profile that set it. Fields are named by
+// their path from the result, such as db.host, and those missing were set by
+// the base document.
+func (e *Evaluator) ProfileSources() map[string]string {
+	return e.profileSources
+}
+
+// applyProfiles merges the overlays of the selected profiles into result, an
+// object whose fields they can refer to. The fields they set are reported
+// unless the document is imported.
+func (e *Evaluator) applyProfiles(profiles []*ast.Profile, result ast.Value, env *Environment, imported bool) (ast.Value, error) {
+	declared := make(map[string]bool)
+	for _, pr := range profiles {
+		name := pr.Name.Value
+		if declared[name] {
+			return nil, newError(pr.Name.Token, "duplicate profile %s", name)
+		}
+		declared[name] = true
+		e.declaredProfiles[name] = true
+
+		if !e.profileSelected(name) {
+			continue
+		}
+
+		base, ok := result.(*ast.ObjectValue)
+		if !ok {
+			return nil, newError(pr.Token, "profile %s cannot overlay %s", name, typeName(result))
+		}
+
+		scope := NewEnclosedEnvironment(env)
+		for _, att := range base.Attributes {
+			scope.Set(att.Key, att.V)
+		}
+		v, err := e.Eval(pr.Overlay, scope)
+		if err != nil {
+			return nil, err
+		}
+		overlay, ok := v.(*ast.ObjectValue)
+		if !ok {
+			return nil, newError(pr.Token, "profile %s must be an object, got %s", name, typeName(v))
+		}
+
+		merged, err := e.mergeObjects(Step{Kind: StepProfile, Name: name, File: env.file, Token: pr.Token}, base, overlay)
+		if err != nil {
+			return nil, err
+		}
+		// Only the fields of the evaluated file are reported, not those of
+		// its imports
+		if !imported {
+			e.recordSources("", name, base, overlay, merged)
+		}
+		result = merged
+	}
+
+	return result, nil
+}
+
+func (e *Evaluator) profileSelected(name string) bool {
+	for _, p := range e.profiles {
+		if p == name {
+			return true
+		}
+	}
+	return false
+}
+
+// checkProfiles fails when a selected profile was declared by none of the
+// evaluated files.
+func (e *Evaluator) checkProfiles() error {
+	for _, name := range e.profiles {
+		if !e.declaredProfiles[name] {
+			return fmt.Errorf("Error: unknown profile %s", name)
+		}
+	}
+	return nil
+}
+
+// recordSources records profile as the source of the fields that overlay sets
+// in merged, the merge of overlay into base. path is the path of base.
+func (e *Evaluator) recordSources(path, profile string, base, overlay, merged *ast.ObjectValue) {
+	for _, att := range overlay.Attributes {
+		i := attributeIndex(merged, att.Key)
+		if i < 0 || merged.Attributes[i].Hidden {
+			continue
+		}
+		p := att.Key
+		if path != "" {
+			p = path + "." + att.Key
+		}
+
+		if att.Merge == ast.MergeDeep {
+			if j := attributeIndex(base, att.Key); j >= 0 {
+				b, bok := base.Attributes[j].V.(*ast.ObjectValue)
+				o, ook := att.V.(*ast.ObjectValue)
+				m, mok := merged.Attributes[i].V.(*ast.ObjectValue)
+				if bok && ook && mok {
+					e.recordSources(p, profile, b, o, m)
+					continue
+				}
+			}
+		}
+
+		for k := range e.profileSources {
+			if strings.HasPrefix(k, p+".") {
+				delete(e.profileSources, k)
+			}
+		}
+		e.profileSources[p] = profile
+	}
+}
@@ -0,0 +1,108 @@
+package evaluator
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+const profiles = `{
+  replicas: 1,
+  db: {host: "localhost", port: 5432},
+  debug: true
+}
+profile staging {db: {host: "db.staging"}, tags: ["staging"]}
+profile prod {replicas: replicas * 3, db: {host: "db.prod"}, debug: false, tags!: ["prod"]}
+assert replicas < 5`
+
+func TestProfiles(t *testing.T) {
+	tests := []struct {
+		profiles []string
+		expected string
+		sources  map[string]string
+	}{
+		{nil, `{"replicas":1, "db":{"host":"localhost", "port":5432}, "debug":true}`, map[string]string{}},
+		{
+			[]string{"staging"},
+			`{"replicas":1, "db":{"host":"db.staging", "port":5432}, "debug":true, "tags":["staging"]}`,
+			map[string]string{"db.host": "staging", "tags": "staging"},
+		},
+		// Profiles apply in the order they are declared
+		{
+			[]string{"prod", "staging"},
+			`{"replicas":3, "db":{"host":"db.prod", "port":5432}, "debug":false, "tags":["prod"]}`,
+			map[string]string{"replicas": "prod", "db.host": "prod", "debug": "prod", "tags": "prod"},
+		},
+	}
+
+	for _, tt := range tests {
+		e := New(WithProfiles(tt.profiles...))
+		evaluated, err := e.EvalDocument(parse(t, profiles))
+		if err != nil {
+			t.Errorf("%v: unexpected error %v", tt.profiles, err)
+			continue
+		}
+		if evaluated.String() != tt.expected {
+			t.Errorf("%v: expected=%q, got=%q", tt.profiles, tt.expected, evaluated.String())
+		}
+		if !reflect.DeepEqual(e.ProfileSources(), tt.sources) {
+			t.Errorf("%v: expected sources %v, got=%v", tt.profiles, tt.sources, e.ProfileSources())
+		}
+	}
+}
+
+func TestProfileErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		profiles []string
+		expected string
+	}{
+		{profiles, []string{"qa"}, "unknown profile qa"},
+		{profiles, []string{"prod", "qa"}, "unknown profile qa"},
+		{"{a: 1}\nprofile p {a: 2}\nprofile p {a: 3}", nil, "duplicate profile p - line 3 column 9"},
+		{"[1]\nprofile p {a: 2}", []string{"p"}, "profile p cannot overlay array - line 2 column 1"},
+		{"{a: 1}\nprofile p [2]", []string{"p"}, "profile p must be an object, got array - line 2 column 1"},
+		{"{a: int}\nprofile p {a: \"x\"}", []string{"p"}, "invalid value \"x\" for a"},
+		{profiles + "\nprofile big {replicas: 9}", []string{"big"}, "assertion failed: (replicas < 5)"},
+		{"{db: {port: 5432, assert port > 1024 : \"privileged port\"}}\nprofile p {db: {port: 80}}", []string{"p"}, "assertion failed: privileged port"},
+	}
+
+	for _, tt := range tests {
+		_, err := New(WithProfiles(tt.profiles...)).EvalDocument(parse(t, tt.input))
+		if err == nil {
+			t.Errorf("%q: expected an error", tt.input)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("%q: expected error containing %q, got=%q", tt.input, tt.expected, err.Error())
+		}
+	}
+}
+
+func TestProfilesInImports(t *testing.T) {
+	fsys := fstest.MapFS{
+		"main.ynt": file(`{db: import "db.ynt"}`),
+		"db.ynt":   file("{host: \"localhost\"}\nprofile prod {host: \"db.prod\"}"),
+	}
+
+	e := New(WithFS(fsys), WithProfiles("prod"))
+	evaluated, err := e.EvalFile("main.ynt")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if evaluated.String() != `{"db":{"host":"db.prod"}}` {
+		t.Errorf("expected=%q, got=%q", `{"db":{"host":"db.prod"}}`, evaluated.String())
+	}
+	if len(e.ProfileSources()) != 0 {
+		t.Errorf("expected no sources, got=%v", e.ProfileSources())
+	}
+
+	e = New(WithFS(fsys), WithProfiles("prod"))
+	if _, err := e.EvalDocument(parse(t, `{db: import "db.ynt"}`)); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(e.ProfileSources()) != 0 {
+		t.Errorf("expected no sources from a document, got=%v", e.ProfileSources())
+	}
+}
@@ -0,0 +1,234 @@
+package evaluator
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/salleaffaire/ynt/ast"
+	"github.com/salleaffaire/ynt/token"
+)
+
+// StepKind is what a Step of the provenance of a value did.
+type StepKind int
+
+const (
+	// The value was given to a field, directly or through a reference
+	StepField StepKind = iota
+	// The value came from an operand of +
+	StepMerge
+	// The value came from a ...spread
+	StepSpread
+	// The value came from the overlay of a profile
+	StepProfile
+	// The value came from the default of a pattern
+	StepPattern
+)
+
+// Step is a step of the provenance of a value. Name is the name of the field
+// or of the profile, or the key of the pattern.
+type Step struct {
+	Kind  StepKind
+	Name  string
+	File  string
+	Token token.Token
+}
+
+func (s Step) String() string {
+	switch s.Kind {
+	case StepMerge:
+		return "merged by + - " + position(s.File, s.Token)
+	case StepSpread:
+		return "spread - " + position(s.File, s.Token)
+	case StepProfile:
+		return "overlaid by profile " + s.Name + " - " + position(s.File, s.Token)
+	case StepPattern:
+		return "default of pattern " + s.Name + " - " + position(s.File, s.Token)
+	}
+	return "field " + s.Name + " - " + position(s.File, s.Token)
+}
+
+// WithProvenance makes the evaluator record where the values of the output
+// come from, for Explain.
+func WithProvenance() Option {
+	return func(e *Evaluator) {
+		e.provenance = true
+	}
+}
+
+// Explain returns the provenance of the output value at path in the last
+// evaluation, latest step first: the field that set it, then the merges, spreads,
+// profiles and references it went through, down to the field where it was
+// written. path is made of field names and array indexes separated by dots,
+// such as db.hosts.0. An array element is explained by the field of the array,
+// and a field of an object given to a field through a reference starts with
+// that reference.
+func (e *Evaluator) Explain(path string) ([]Step, error) {
+	if !e.provenance {
+		return nil, fmt.Errorf("Error: provenance is not recorded")
+	}
+	if e.result == nil {
+		return nil, fmt.Errorf("Error: nothing was evaluated")
+	}
+
+	var prefix, chain []Step
+	v := e.result
+	for _, name := range strings.Split(path, ".") {
+		switch c := v.(type) {
+		case *ast.ObjectValue:
+			att, ok := visibleAttribute(c, name)
+			if !ok {
+				return nil, fmt.Errorf("Error: no field %s in %s", name, path)
+			}
+			if isReference(chain) {
+				prefix = append(prefix, chain...)
+			}
+			chain = e.chains[c][name]
+			v = att.V
+		case *ast.ArrayValue:
+			i, err := strconv.Atoi(name)
+			if err != nil || i < 0 || i >= len(c.Values) {
+				return nil, fmt.Errorf("Error: no element %s in %s", name, path)
+			}
+			v = c.Values[i]
+		default:
+			return nil, fmt.Errorf("Error: %s is not an object or an array in %s", name, path)
+		}
+	}
+
+	steps := append(prefix, chain...)
+	if e.fileNames != nil {
+		steps = append([]Step{}, steps...)
+		for i, step := range steps {
+			if step.File != "" {
+				steps[i].File = e.fileName(step.File)
+			}
+		}
+	}
+	return steps, nil
+}
+
+// isReference reports whether chain is the provenance of a value given to a
+// field through references to other fields, whose own fields do not record it.
+func isReference(chain []Step) bool {
+	if len(chain) < 2 {
+		return false
+	}
+	for _, step := range chain {
+		if step.Kind != StepField {
+			return false
+		}
+	}
+	return true
+}
+
+func visibleAttribute(ov *ast.ObjectValue, key string) (ast.Attribute, bool) {
+	for _, att := range ov.Attributes {
+		if att.Key == key && !att.Hidden {
+			return att, true
+		}
+	}
+	return ast.Attribute{}, false
+}
+
+// fieldChain returns the provenance of the value v of the field att, and
+// records it as the one of v so that the fields referring to v continue it.
+func (e *Evaluator) fieldChain(file string, att ast.Attribute, v ast.Value) []Step {
+	step := Step{Kind: StepField, Name: att.Key, File: file, Token: att.Token}
+	chain := []Step{step}
+	if prev, ok := e.valueChains[v]; ok && prev[0] != step {
+		chain = append(chain, prev...)
+	}
+	e.valueChains[v] = chain
+	return chain
+}
+
+// mergeAttribute merges att, whose provenance is chain, into dst by step, and
+// records the provenance of the result.
+func (e *Evaluator) mergeAttribute(step Step, dst *ast.ObjectValue, att ast.Attribute, chain []Step) error {
+	if !e.provenance {
+		return mergeAttribute(step.Token, dst, att)
+	}
+
+	var old *ast.Attribute
+	if i := attributeIndex(dst, att.Key); i >= 0 {
+		a := dst.Attributes[i]
+		old = &a
+	}
+	oldChain := e.chains[dst][att.Key]
+
+	if e.strict && old != nil {
+		if err := e.checkConflict(step.Token, att.Key, *old, oldChain, att, chain); err != nil {
+			return err
+		}
+	}
+	if err := mergeAttribute(step.Token, dst, att); err != nil {
+		return err
+	}
+	e.recordAttribute(step, dst, old, oldChain, att, chain)
+	return nil
+}
+
+// recordAttribute records the provenance of the attribute of dst that att,
+// whose provenance is chain, was just merged into. old is the attribute it
+// was merged with, if any, and step the merge.
+func (e *Evaluator) recordAttribute(step Step, dst *ast.ObjectValue, old *ast.Attribute, oldChain []Step, att ast.Attribute, chain []Step) {
+	i := attributeIndex(dst, att.Key)
+	if i < 0 {
+		return
+	}
+	merged := dst.Attributes[i]
+
+	switch {
+	case old == nil || merged.V == att.V:
+		e.setChain(dst, att.Key, chain)
+	case merged.V == old.V:
+		e.setChain(dst, att.Key, oldChain)
+	default:
+		l, lok := old.V.(*ast.ObjectValue)
+		r, rok := att.V.(*ast.ObjectValue)
+		m, mok := merged.V.(*ast.ObjectValue)
+		if lok && rok && mok {
+			e.recordMerge(step, l, r, m)
+		}
+		e.setChain(dst, att.Key, append(append([]Step{}, chain...), oldChain...))
+	}
+}
+
+// recordMerge records the provenance of the fields of merged, the merge of
+// right into left by step. The fields of both operands continue with step and
+// the field the operand was referred to through, if any.
+func (e *Evaluator) recordMerge(step Step, left, right, merged *ast.ObjectValue) {
+	leftPrefix := e.operandChain(step, left)
+	for key, chain := range e.chains[left] {
+		e.setChain(merged, key, append(append([]Step{}, leftPrefix...), chain...))
+	}
+
+	rightPrefix := append([]Step{step}, e.valueChains[right]...)
+	for _, att := range right.Attributes {
+		chain := append(append([]Step{}, rightPrefix...), e.chains[right][att.Key]...)
+		var old *ast.Attribute
+		if j := attributeIndex(left, att.Key); j >= 0 {
+			old = &left.Attributes[j]
+		}
+		e.recordAttribute(step, merged, old, e.chains[merged][att.Key], att, chain)
+	}
+}
+
+// operandChain returns the steps the fields of left, the left operand of a
+// merge by step, continue with. The document a profile overlays is not part of
+// the provenance of its fields.
+func (e *Evaluator) operandChain(step Step, left *ast.ObjectValue) []Step {
+	ref := e.valueChains[left]
+	if step.Kind == StepProfile && ref == nil {
+		return nil
+	}
+	return append([]Step{step}, ref...)
+}
+
+func (e *Evaluator) setChain(ov *ast.ObjectValue, key string, chain []Step) {
+	if e.chains[ov] == nil {
+		e.chains[ov] = make(map[string][]Step)
+	}
+	e.chains[ov][key] = chain
+}
@@ -0,0 +1,183 @@
+package evaluator
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestExplain(t *testing.T) {
+	fsys := fstest.MapFS{
+		"defaults.ynt": file("{\n  timeout: 10\n}"),
+		"main.ynt": file(`{
+  defaults:: import "defaults.ynt",
+  base:: {timeout: defaults.timeout, db: {host: "localhost", port: 5432}},
+  service: base + {db: {host: "db"}},
+  other: {...base, timeout: 20},
+  hosts: [{name: "a"}]
+}
+profile prod {service: {timeout: 60}}`),
+	}
+
+	tests := []struct {
+		profiles []string
+		path     string
+		expected []string
+	}{
+		{nil, "service.timeout", []string{
+			"merged by + - main.ynt line 4 column 17",
+			"field base - main.ynt line 3 column 3",
+			"field timeout - main.ynt line 3 column 11",
+			"field timeout - defaults.ynt line 2 column 3",
+		}},
+		{nil, "service.db.host", []string{
+			"merged by + - main.ynt line 4 column 17",
+			"field db - main.ynt line 4 column 20",
+			"field host - main.ynt line 4 column 25",
+		}},
+		{nil, "service.db.port", []string{
+			"merged by + - main.ynt line 4 column 17",
+			"field db - main.ynt line 3 column 38",
+			"field port - main.ynt line 3 column 62",
+		}},
+		{nil, "other.db", []string{
+			"spread - main.ynt line 5 column 11",
+			"field db - main.ynt line 3 column 38",
+		}},
+		{nil, "other.timeout", []string{
+			"field timeout - main.ynt line 5 column 20",
+		}},
+		{nil, "hosts.0.name", []string{
+			"field name - main.ynt line 6 column 12",
+		}},
+		{[]string{"prod"}, "service.timeout", []string{
+			"overlaid by profile prod - main.ynt line 8 column 1",
+			"field service - main.ynt line 8 column 15",
+			"field timeout - main.ynt line 8 column 25",
+		}},
+	}
+
+	for _, tt := range tests {
+		e := New(WithFS(fsys), WithProvenance(), WithProfiles(tt.profiles...))
+		if _, err := e.EvalFile("main.ynt"); err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+
+		steps, err := e.Explain(tt.path)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tt.path, err)
+			continue
+		}
+		got := []string{}
+		for _, step := range steps {
+			got = append(got, step.String())
+		}
+		if strings.Join(got, "\n") != strings.Join(tt.expected, "\n") {
+			t.Errorf("%s: expected=%q, got=%q", tt.path, tt.expected, got)
+		}
+	}
+}
+
+func TestExplainPatterns(t *testing.T) {
+	fsys := fstest.MapFS{
+		"main.ynt": file("{\n  [name=string]: {replicas: 1},\n  web: {port: 80}\n}"),
+	}
+
+	e := New(WithFS(fsys), WithProvenance())
+	if _, err := e.EvalFile("main.ynt"); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	steps, err := e.Explain("web.replicas")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	expected := []string{
+		"default of pattern [name=string] - main.ynt line 2 column 3",
+		"field replicas - main.ynt line 2 column 19",
+	}
+	got := []string{}
+	for _, step := range steps {
+		got = append(got, step.String())
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected=%q, got=%q", expected, got)
+	}
+}
+
+func TestExplainReferences(t *testing.T) {
+	fsys := fstest.MapFS{
+		"main.ynt": file(`{
+  a:: {db: {host: "h"}},
+  other: a.db,
+  hosts:: [{name: "x"}],
+  hs: hosts
+}`),
+	}
+
+	e := New(WithFS(fsys), WithProvenance())
+	if _, err := e.EvalFile("main.ynt"); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	tests := []struct {
+		path     string
+		expected []string
+	}{
+		{"other.host", []string{
+			"field other - main.ynt line 3 column 3",
+			"field db - main.ynt line 2 column 8",
+			"field host - main.ynt line 2 column 13",
+		}},
+		{"hs.0.name", []string{
+			"field hs - main.ynt line 5 column 3",
+			"field hosts - main.ynt line 4 column 3",
+			"field name - main.ynt line 4 column 13",
+		}},
+	}
+
+	for _, tt := range tests {
+		steps, err := e.Explain(tt.path)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tt.path, err)
+			continue
+		}
+		got := []string{}
+		for _, step := range steps {
+			got = append(got, step.String())
+		}
+		if strings.Join(got, "\n") != strings.Join(tt.expected, "\n") {
+			t.Errorf("%s: expected=%q, got=%q", tt.path, tt.expected, got)
+		}
+	}
+}
+
+func TestExplainErrors(t *testing.T) {
+	input := `{a: {b: [1]}, h:: 1}`
+
+	e := New(WithProvenance())
+	if _, err := e.EvalDocument(parse(t, input)); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"x", "no field x in x"},
+		{"h", "no field h in h"},
+		{"a.b.1", "no element 1 in a.b.1"},
+		{"a.b.0.c", "c is not an object or an array in a.b.0.c"},
+	}
+
+	for _, tt := range tests {
+		_, err := e.Explain(tt.path)
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("%s: expected error containing %q, got=%v", tt.path, tt.expected, err)
+		}
+	}
+
+	if _, err := New().Explain("a"); err == nil || !strings.Contains(err.Error(), "provenance is not recorded") {
+		t.Errorf("expected an error without provenance, got=%v", err)
+	}
+}
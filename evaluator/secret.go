@@ -0,0 +1,164 @@
+package evaluator
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"strings"
+
+	"github.com/salleaffaire/ynt/ast"
+	"github.com/salleaffaire/ynt/token"
+)
+
+// ErrSecretNotFound is returned by a SecretProvider that has no secret of the
+// name asked for.
+var ErrSecretNotFound = errors.New("secret not found")
+
+// SecretProvider resolves the secrets referred to by secret(name).
+type SecretProvider interface {
+	Secret(name string) (string, error)
+}
+
+// DirSecrets reads the secret a/b from the file a/b of FS, without its
+// trailing newline, as in a directory of mounted secrets.
+type DirSecrets struct {
+	FS fs.FS
+}
+
+func (d DirSecrets) Secret(name string) (string, error) {
+	b, err := fs.ReadFile(d.FS, name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", ErrSecretNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(string(b), "\n"), nil
+}
+
+// EnvSecrets reads the secret db/password from the environment variable
+// PREFIX_DB_PASSWORD: the name is upper cased, its characters other than
+// letters and digits become underscores, and it follows Prefix, if any, and an
+// underscore.
+type EnvSecrets struct {
+	Prefix string
+}
+
+func (p EnvSecrets) Secret(name string) (string, error) {
+	v, ok := os.LookupEnv(p.variable(name))
+	if !ok {
+		return "", ErrSecretNotFound
+	}
+	return v, nil
+}
+
+func (p EnvSecrets) variable(name string) string {
+	variable := strings.Map(func(r rune) rune {
+		switch {
+		case 'a' <= r && r <= 'z':
+			return r - 'a' + 'A'
+		case 'A' <= r && r <= 'Z', '0' <= r && r <= '9':
+			return r
+		}
+		return '_'
+	}, name)
+	if p.Prefix == "" {
+		return variable
+	}
+	return p.Prefix + "_" + variable
+}
+
+// WithSecrets makes secret() resolve secrets with provider. Without it,
+// secret() fails.
+func WithSecrets(provider SecretProvider) Option {
+	return func(e *Evaluator) {
+		e.secrets = provider
+	}
+}
+
+// lookupSecret returns the secret name, marked Secret.
+func (e *Evaluator) lookupSecret(tok token.Token, name *ast.StringValue) (ast.Value, error) {
+	if e.secrets == nil {
+		return nil, newError(tok, "cannot read secret %s: no secret provider", showName(name))
+	}
+
+	v, err := e.secrets.Secret(name.Value)
+	if errors.Is(err, ErrSecretNotFound) {
+		return nil, newError(tok, "secret %s is not found", showName(name))
+	}
+	if err != nil {
+		// The error of the provider can hold the name
+		if name.Secret {
+			return nil, newError(tok, "cannot read secret %s", showName(name))
+		}
+		return nil, newError(tok, "cannot read secret %s: %v", name.Value, err)
+	}
+
+	s := newString(tok, v)
+	s.Secret = true
+	return s, nil
+}
+
+// markSecret returns result with its strings marked Secret when they are made
+// from a secret among args: a string made from any secret, or the strings of an
+// array or an object made from a secret string.
+func markSecret(result ast.Value, args ...ast.Value) ast.Value {
+	switch result.(type) {
+	case *ast.StringValue:
+		for _, arg := range args {
+			if ast.HasSecret(arg) {
+				return secretValue(result)
+			}
+		}
+	case *ast.ArrayValue, *ast.ObjectValue:
+		for _, arg := range args {
+			if s, ok := arg.(*ast.StringValue); ok && s.Secret {
+				return secretValue(result)
+			}
+		}
+	}
+	return result
+}
+
+// secretValue returns v with every string it holds marked Secret.
+func secretValue(v ast.Value) ast.Value {
+	switch v := v.(type) {
+	case *ast.StringValue:
+		if v.Secret {
+			return v
+		}
+		marked := *v
+		marked.Secret = true
+		return &marked
+
+	case *ast.ArrayValue:
+		result := &ast.ArrayValue{Token: v.Token, Values: make([]ast.Value, 0, len(v.Values))}
+		for _, elem := range v.Values {
+			result.Values = append(result.Values, secretValue(elem))
+		}
+		return result
+
+	case *ast.ObjectValue:
+		result := &ast.ObjectValue{Token: v.Token, Attributes: make([]ast.Attribute, 0, len(v.Attributes))}
+		for _, att := range v.Attributes {
+			att.V = secretValue(att.V)
+			result.Attributes = append(result.Attributes, att)
+		}
+		return result
+	}
+	return v
+}
+
+// showName returns the string s as it is shown in error messages, unquoted, or
+// Redacted when it is a secret.
+func showName(s *ast.StringValue) string {
+	if s.Secret {
+		return ast.Redacted
+	}
+	return s.Value
+}
+
+// show returns v as it is shown in error messages, with its secrets redacted.
+func show(v ast.Value) string {
+	return ast.Redact(v).String()
+}
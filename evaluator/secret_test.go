@@ -0,0 +1,118 @@
+package evaluator
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/salleaffaire/ynt/ast"
+)
+
+func TestSecrets(t *testing.T) {
+	provider := DirSecrets{FS: fstest.MapFS{"db/password": file("hunter2\n")}}
+
+	tests := []struct {
+		input    string
+		expected string
+		redacted string
+	}{
+		{`{password: secret("db/password")}`, `{"password":"hunter2"}`, `{"password":"<redacted>"}`},
+		{`{dsn: "app:" + secret("db/password") + "@db"}`, `{"dsn":"app:hunter2@db"}`, `{"dsn":"<redacted>"}`},
+		{`{dsn: format("app:%s@db", secret("db/password"))}`, `{"dsn":"app:hunter2@db"}`, `{"dsn":"<redacted>"}`},
+		{`{p: upper(secret("db/password")), n: length(secret("db/password"))}`, `{"p":"HUNTER2", "n":7}`, `{"p":"<redacted>", "n":7}`},
+		{`{parts: split(secret("db/password"), "t"), n: split("a-b", "-")}`, `{"parts":["hun", "er2"], "n":["a", "b"]}`, `{"parts":["<redacted>", "<redacted>"], "n":["a", "b"]}`},
+		{`{f: find(secret("db/password"), re"\d"), c: captures(secret("db/password"), re"^(?P<head>[a-z]+)")}`, `{"f":["2"], "c":{"head":"hunter"}}`, `{"f":["<redacted>"], "c":{"head":"<redacted>"}}`},
+		{`{users: [{name: "app", password: secret("db/password")}]}`, `{"users":[{"name":"app", "password":"hunter2"}]}`, `{"users":[{"name":"app", "password":"<redacted>"}]}`},
+	}
+
+	for _, tt := range tests {
+		evaluated, err := New(WithSecrets(provider)).EvalDocument(parse(t, tt.input))
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", tt.input, err)
+			continue
+		}
+		if evaluated.String() != tt.expected {
+			t.Errorf("%q: expected=%q, got=%q", tt.input, tt.expected, evaluated.String())
+		}
+		if ast.Redact(evaluated).String() != tt.redacted {
+			t.Errorf("%q: expected redacted=%q, got=%q", tt.input, tt.redacted, ast.Redact(evaluated).String())
+		}
+	}
+}
+
+func TestEnvSecrets(t *testing.T) {
+	t.Setenv("APP_DB_PASSWORD", "s3cret")
+	t.Setenv("API_KEY", "k")
+
+	tests := []struct {
+		provider EnvSecrets
+		name     string
+		expected string
+	}{
+		{EnvSecrets{Prefix: "APP"}, "db/password", "s3cret"},
+		{EnvSecrets{}, "api-key", "k"},
+	}
+
+	for _, tt := range tests {
+		v, err := tt.provider.Secret(tt.name)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+			continue
+		}
+		if v != tt.expected {
+			t.Errorf("%s: expected=%q, got=%q", tt.name, tt.expected, v)
+		}
+	}
+
+	if _, err := (EnvSecrets{Prefix: "APP"}).Secret("missing"); err != ErrSecretNotFound {
+		t.Errorf("expected ErrSecretNotFound, got=%v", err)
+	}
+}
+
+func TestSecretErrors(t *testing.T) {
+	provider := DirSecrets{FS: fstest.MapFS{"token": file("abc")}}
+
+	tests := []struct {
+		input    string
+		provider SecretProvider
+		expected string
+	}{
+		{`{a: secret("token")}`, nil, "cannot read secret token: no secret provider - line 1 column 11"},
+		{`{a: secret("other")}`, provider, "secret other is not found - line 1 column 11"},
+		{`{a: secret("token"), assert a == "x" : "bad token " + a}`, provider, "assertion failed: <redacted>"},
+		{`{a: int} + {a: secret("token")}`, provider, `invalid value "<redacted>" for a`},
+		{`secret("token") & "x"`, provider, `conflicting values "<redacted>" and "x"`},
+		{`{a: string | secret("token")}`, provider, `field a is incomplete: string | "<redacted>"`},
+		{`{a: (*"x" | secret("token")) & int}`, provider, `field a is incomplete: (*"x" | "<redacted>") & int`},
+		{`{a: >secret("token")} + {a: "a"}`, provider, `invalid value "a" for a: does not satisfy >"<redacted>"`},
+		{`env(secret("token"))`, provider, "environment variable <redacted> is not set"},
+		{`secret(secret("token"))`, provider, "secret <redacted> is not found"},
+		{`uuidv5(secret("token"), "x")`, provider, `uuidv5: invalid namespace "<redacted>"`},
+		{`format(secret("token") + "%")`, provider, `format: incomplete verb "<redacted>"`},
+		{`format(secret("token") + "%d")`, provider, "format: missing argument for <redacted>"},
+		{`{a: 1}[secret("token")]`, provider, `field "<redacted>" not found`},
+		{`{a: self[secret("token")]}`, provider, "field a is incomplete: self.<redacted>"},
+		{`{a: super[secret("token")]}`, provider, "field a is incomplete: super.<redacted>"},
+		{`{[secret("token")]: 1}`, provider, "object key cannot be a secret - line 1 column 2"},
+		{`{for p in [secret("token")]: p: 1}`, provider, "object key cannot be a secret - line 1 column 2"},
+		{`error("bad token " + secret("token"))`, provider, "Error: <redacted> - line 1 column 6"},
+	}
+
+	for _, tt := range tests {
+		options := []Option{}
+		if tt.provider != nil {
+			options = append(options, WithSecrets(tt.provider))
+		}
+		_, err := New(options...).EvalDocument(parse(t, tt.input))
+		if err == nil {
+			t.Errorf("%q: expected an error", tt.input)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("%q: expected error containing %q, got=%q", tt.input, tt.expected, err.Error())
+		}
+		if strings.Contains(err.Error(), "abc") {
+			t.Errorf("%q: error reveals the secret: %q", tt.input, err.Error())
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package evaluator
+
+import (
+	"errors"
+
+	"github.com/salleaffaire/ynt/ast"
+	"github.com/salleaffaire/ynt/token"
+)
+
+// layer is an object literal to evaluate in env, or an object value, merged
+// with the layers that follow it into an object that self refers to.
+type layer struct {
+	lit   *ast.ObjectValue
+	env   *Environment
+	value *ast.ObjectValue
+}
+
+// object is an object being evaluated from layers. The literals of its layers,
+// with their computed keys evaluated, are bound in scopes.
+type object struct {
+	layers []layer
+	lits   []*ast.ObjectValue
+	scopes []*Environment
+}
+
+// instantiate evaluates the layers and merges them in order by step, with self
+// referring to the result in each of their literals and super to the merge of
+// the layers before it. The result keeps its layers, so that merging it again
+// evaluates them again.
+func (e *Evaluator) instantiate(step Step, layers []layer) (*ast.ObjectValue, error) {
+	obj := &object{layers: layers, lits: make([]*ast.ObjectValue, len(layers)), scopes: make([]*Environment, len(layers))}
+	for i, l := range layers {
+		if l.lit == nil {
+			continue
+		}
+		scope := NewEnclosedEnvironment(l.env)
+		scope.object, scope.layer = obj, i
+		lit, err := e.bindObject(l.lit, scope)
+		if err != nil {
+			return nil, locate(err, scope)
+		}
+		obj.lits[i], obj.scopes[i] = lit, scope
+	}
+
+	var result *ast.ObjectValue
+	for i, l := range layers {
+		v := l.value
+		if l.lit != nil {
+			var err error
+			if v, err = e.evalFields(obj.lits[i], obj.scopes[i]); err != nil {
+				return nil, locate(err, obj.scopes[i])
+			}
+		}
+		if result == nil {
+			result = v
+			continue
+		}
+		merged, err := e.mergeObjects(step, result, v)
+		if err != nil {
+			return nil, err
+		}
+		result = merged
+	}
+
+	if e.layers == nil {
+		e.layers = make(map[*ast.ObjectValue][]layer)
+	}
+	e.layers[result] = layers
+	return result, nil
+}
+
+// layersOf returns the layers ov was evaluated from, or ov itself.
+func (e *Evaluator) layersOf(ov *ast.ObjectValue) []layer {
+	if layers, ok := e.layers[ov]; ok {
+		return layers
+	}
+	return []layer{{value: ov}}
+}
+
+// mergeObjects returns the deep merge of right into left by step. Objects
+// evaluated from layers are evaluated again from the layers of both, so that
+// self refers to the merge.
+func (e *Evaluator) mergeObjects(step Step, left, right *ast.ObjectValue) (*ast.ObjectValue, error) {
+	if e.layers[left] != nil || e.layers[right] != nil {
+		layers := append(append([]layer{}, e.layersOf(left)...), e.layersOf(right)...)
+		return e.instantiate(step, layers)
+	}
+
+	// Profiles overlay the values of the document even in strict mode
+	if e.strict && step.Kind != StepProfile {
+		if err := e.checkMerge(step.Token, "", left, right); err != nil {
+			return nil, err
+		}
+	}
+
+	result := &ast.ObjectValue{Token: left.Token, Attributes: append([]ast.Attribute{}, left.Attributes...)}
+	for _, att := range right.Attributes {
+		if err := e.mergeField(step, result, att); err != nil {
+			return nil, err
+		}
+	}
+	if e.provenance {
+		e.recordMerge(step, left, right, result)
+	}
+	if err := e.recheck(left, right, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// mergeField merges att into the attributes of dst by step, like
+// mergeAttribute, merging objects evaluated from layers with mergeObjects.
+func (e *Evaluator) mergeField(step Step, dst *ast.ObjectValue, att ast.Attribute) error {
+	if i := attributeIndex(dst, att.Key); i >= 0 && att.Merge == ast.MergeDeep {
+		l, lok := dst.Attributes[i].V.(*ast.ObjectValue)
+		r, rok := att.V.(*ast.ObjectValue)
+		if lok && rok && (e.layers[l] != nil || e.layers[r] != nil) {
+			merged, err := e.mergeObjects(step, l, r)
+			if err != nil {
+				return err
+			}
+			att.V, att.Merge = merged, ast.MergeReplace
+		}
+	}
+	return mergeAttribute(step.Token, dst, att)
+}
+
+// missingLate is the cause of the error of selecting name, a missing field of
+// self or super, from a literal of object. The field of the literal whose
+// value needs it is left incomplete instead of failing, as the literal can
+// still be merged with an object that has it.
+type missingLate struct {
+	object *object
+	name   string
+}
+
+func (m *missingLate) Error() string {
+	return m.name + " not found"
+}
+
+// objectScope returns the scope of the object literal that self and super
+// refer to from env, if any.
+func objectScope(env *Environment) *Environment {
+	for env != nil && env.object == nil {
+		env = env.outer
+	}
+	return env
+}
+
+// lateNotFound returns the error of selecting the missing field key of node,
+// self or super, written in env. key is shown as in error messages, so that a
+// secret key is redacted in the error and in the incomplete field it leaves.
+func lateNotFound(node ast.Value, tok token.Token, key string, env *Environment) error {
+	err := newError(tok, "field %s not found in %s", key, node.String())
+	if scope := objectScope(env); scope != nil {
+		err.Err = &missingLate{object: scope.object, name: node.String() + "." + key}
+	}
+	return err
+}
+
+// incomplete returns the value of a field of the literal bound in scope whose
+// evaluation failed with err, when err is a missingLate of its object: a
+// constraint named after the missing field, which no value satisfies.
+func incomplete(scope *Environment, err error) (ast.Value, bool) {
+	var m *missingLate
+	if scope.object == nil || !errors.As(err, &m) || m.object != scope.object {
+		return nil, false
+	}
+	return &ast.TypeConstraint{Token: err.(*Error).Token, Name: m.name}, true
+}
+
+// selectLate returns the field key of node, self or super, written in env. ok
+// is false when there is no such field.
+func (e *Evaluator) selectLate(node ast.Value, key string, env *Environment) (ast.Value, bool, error) {
+	scope := objectScope(env)
+	if scope == nil {
+		return nil, false, newError(lateToken(node), "%s outside of an object", node.String())
+	}
+
+	obj := scope.object
+	n := len(obj.layers)
+	if _, ok := node.(*ast.SuperExpression); ok {
+		n = scope.layer
+	}
+
+	dst := &ast.ObjectValue{}
+	for i := 0; i < n; i++ {
+		atts, err := e.layerAttributes(obj, i, key)
+		if err != nil {
+			return nil, false, err
+		}
+		for _, att := range atts {
+			if err := e.mergeField(Step{Kind: StepMerge, File: env.file, Token: lateToken(node)}, dst, att); err != nil {
+				return nil, false, err
+			}
+		}
+	}
+	if len(dst.Attributes) == 0 {
+		return nil, false, nil
+	}
+	return dst.Attributes[0].V, true, nil
+}
+
+// layerAttributes returns the attributes of the layer i of obj that set the
+// field key, in order.
+func (e *Evaluator) layerAttributes(obj *object, i int, key string) ([]ast.Attribute, error) {
+	if obj.lits[i] == nil {
+		ov := obj.layers[i].value
+		if j := attributeIndex(ov, key); j >= 0 {
+			return []ast.Attribute{ov.Attributes[j]}, nil
+		}
+		return nil, nil
+	}
+
+	scope := obj.scopes[i]
+	atts := []ast.Attribute{}
+	for _, att := range obj.lits[i].Attributes {
+		if att.Spread {
+			v, err := e.Eval(att.V, scope)
+			if err != nil {
+				return nil, err
+			}
+			if spread, ok := v.(*ast.ObjectValue); ok {
+				if j := attributeIndex(spread, key); j >= 0 {
+					atts = append(atts, spread.Attributes[j])
+				}
+			}
+			continue
+		}
+		if att.Key != key {
+			continue
+		}
+		v, err := e.force(scope.store[key], att.Token)
+		if err != nil {
+			return nil, err
+		}
+		atts = append(atts, evaluatedAttribute(att, v))
+	}
+	return atts, nil
+}
+
+func lateToken(node ast.Value) token.Token {
+	switch n := node.(type) {
+	case *ast.SelfExpression:
+		return n.Token
+	case *ast.SuperExpression:
+		return n.Token
+	}
+	return token.Token{}
+}
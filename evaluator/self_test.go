@@ -0,0 +1,49 @@
+package evaluator
+
+import (
+	"testing"
+)
+
+func TestSelf(t *testing.T) {
+	testEvalString(t, []struct {
+		input    string
+		expected string
+	}{
+		{`{port: 80, url: format("http://db:%d", self.port)}`, `{"port":80, "url":"http://db:80"}`},
+		{`{base:: {port: 80, url: format(":%d", self.port)}, prod: base + {port: 443}}.prod`, `{"port":443, "url":":443"}`},
+		{`{base:: {port: 80}, next: base + {port: super.port + 1}}.next`, `{"port":81}`},
+		{`{base:: {tags: ["a"]}, m:: {tags: super.tags + ["m"]}, x: base + m + m}.x`, `{"tags":["a", "m", "m"]}`},
+		{`{base:: {a: 1, b: self.a * 2}, x: (base + {a: 2}) + {a: 3}}.x`, `{"a":3, "b":6}`},
+		{`{db: {name: "app", dsn: self.name + "@db"}} + {db: {name: "other"}}`, `{"db":{"name":"other", "dsn":"other@db"}}`},
+		{`{a: super?.a ?? 1, b: super.b ?? 2, c: self["a"]}`, `{"a":1, "b":2, "c":1}`},
+		{`{a: 1, b: a, c: self.a} + {a: 2}`, `{"a":2, "b":1, "c":2}`},
+		{`{a: 1, f: function(x) self.a + x}.f(1)`, `2`},
+	})
+}
+
+func TestSelfErrors(t *testing.T) {
+	testEvalError(t, []struct {
+		input    string
+		expected string
+	}{
+		{`{a: self}`, "self must be followed by a field, as in self.name - line 1 column 5"},
+		{`{a: self.a}`, "cycle in reference to a - line 1 column 2"},
+		{`{a: self.b}`, "field a is incomplete: self.b - line 1 column 2"},
+		{`{m: {t: super.t + [1]}}`, "field t is incomplete: super.t - line 1 column 6"},
+		{`{a: 1} + {b: super.c}`, "field b is incomplete: super.c - line 1 column 11"},
+		{`{a: self[1]}`, "object index must be a string, got number - line 1 column 9"},
+	})
+}
+
+func TestSelfProfile(t *testing.T) {
+	input := "{port: 80, url: format(\":%d\", self.port)}\nprofile prod {port: 443}"
+
+	evaluated, err := New(WithProfiles("prod")).EvalDocument(parse(t, input))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	expected := `{"port":443, "url":":443"}`
+	if evaluated.String() != expected {
+		t.Errorf("expected=%q, got=%q", expected, evaluated.String())
+	}
+}
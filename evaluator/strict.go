@@ -0,0 +1,78 @@
+package evaluator
+
+import (
+	"github.com/salleaffaire/ynt/ast"
+	"github.com/salleaffaire/ynt/token"
+)
+
+// WithStrict makes merging two different concrete values into a field an
+// error, instead of letting the right one win, unless the right one is
+// declared with key!: value. Defaults can still be overridden, and profiles
+// still overlay the values of the document. The evaluator records provenance
+// to report where both values were set.
+func WithStrict() Option {
+	return func(e *Evaluator) {
+		e.strict = true
+		e.provenance = true
+	}
+}
+
+// checkMerge checks that merging right into left by the merge at tok sets no
+// field to conflicting values. prefix is the path of left and right.
+func (e *Evaluator) checkMerge(tok token.Token, prefix string, left, right *ast.ObjectValue) error {
+	for _, att := range right.Attributes {
+		i := attributeIndex(left, att.Key)
+		if i < 0 {
+			continue
+		}
+		err := e.checkConflict(tok, prefix+att.Key, left.Attributes[i], e.chains[left][att.Key], att, e.chains[right][att.Key])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkConflict checks that att, whose provenance is chain, can be merged into
+// old, whose provenance is oldChain, at path.
+func (e *Evaluator) checkConflict(tok token.Token, path string, old ast.Attribute, oldChain []Step, att ast.Attribute, chain []Step) error {
+	if att.Merge != ast.MergeDeep {
+		return nil
+	}
+
+	l, lok := old.V.(*ast.ObjectValue)
+	r, rok := att.V.(*ast.ObjectValue)
+	if lok && rok {
+		return e.checkMerge(tok, path+".", l, r)
+	}
+
+	if !isFixed(old) || !isFixed(att) || equal(old.V, att.V) {
+		return nil
+	}
+	return newError(tok, "conflicting values %s and %s for %s, set at %s and %s",
+		show(old.V), show(att.V), path, origin(old, oldChain), origin(att, chain))
+}
+
+// isFixed reports whether att has a concrete value that is not the default of
+// its constraint.
+func isFixed(att ast.Attribute) bool {
+	if isConstraint(att.V) {
+		return false
+	}
+	if att.Constraint == nil || toConjunction(att.Constraint).Value != nil {
+		return true
+	}
+	d, ok := concrete(att.Constraint)
+	return !ok || d != att.V
+}
+
+// origin returns the position of the field that set att, whose provenance is
+// chain, skipping the fields of the objects it was merged through.
+func origin(att ast.Attribute, chain []Step) string {
+	for _, step := range chain {
+		if step.Kind == StepField && step.Name == att.Key {
+			return position(step.File, step.Token)
+		}
+	}
+	return position("", att.Token)
+}
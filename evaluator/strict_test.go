@@ -0,0 +1,66 @@
+package evaluator
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestStrict(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{a: 1, b: 2} + {a: 1, c: 3}`, `{"a":1, "b":2, "c":3}`},
+		{`{db: {host: "a"}} + {db: {port: 5432}}`, `{"db":{"host":"a", "port":5432}}`},
+		{`{port: 5432} + {port!: 6000}`, `{"port":6000}`},
+		{`{tags: ["a"]} + {tags+: ["b"]}`, `{"tags":["a", "b"]}`},
+		{`{replicas: int | *1} + {replicas: 3}`, `{"replicas":3}`},
+		{`{timeout: duration & >=1s} + {timeout: 30s}`, `{"timeout":"30s"}`},
+		{"{a: 1}\nprofile p {a: 2}", `{"a":1}`},
+	}
+
+	for _, tt := range tests {
+		evaluated, err := New(WithStrict()).EvalDocument(parse(t, tt.input))
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", tt.input, err)
+			continue
+		}
+		if evaluated.String() != tt.expected {
+			t.Errorf("%q: expected=%q, got=%q", tt.input, tt.expected, evaluated.String())
+		}
+	}
+}
+
+func TestStrictErrors(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.ynt":      file("{\n  db: {host: \"db\", port: 5432}\n}"),
+		"b.ynt":      file("{\n  db: {port: 5433}\n}"),
+		"merge.ynt":  file("import \"a.ynt\" as a\nimport \"b.ynt\" as b\na + b"),
+		"spread.ynt": file("import \"a.ynt\" as a\n{...a, db: {port: 6000}}"),
+		"nested.ynt": file("{\n  base:: {timeout: 10},\n  a: (base + {x: 1}) + {timeout: 5}\n}"),
+	}
+
+	tests := []struct {
+		file     string
+		expected string
+	}{
+		{"merge.ynt", "Error: conflicting values 5432 and 5433 for db.port, set at a.ynt line 2 column 20 and b.ynt line 2 column 8 - merge.ynt line 3 column 3"},
+		{"spread.ynt", "Error: conflicting values 5432 and 6000 for db.port, set at a.ynt line 2 column 20 and spread.ynt line 2 column 13 - spread.ynt line 2 column 8"},
+		{"nested.ynt", "Error: conflicting values 10 and 5 for timeout, set at nested.ynt line 2 column 11 and nested.ynt line 3 column 25 - nested.ynt line 3 column 22"},
+	}
+
+	for _, tt := range tests {
+		_, err := New(WithFS(fsys), WithStrict()).EvalFile(tt.file)
+		if err == nil {
+			t.Errorf("%s: expected an error", tt.file)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("%s: expected=%q, got=%q", tt.file, tt.expected, err.Error())
+		}
+	}
+
+	if _, err := New(WithFS(fsys)).EvalFile("merge.ynt"); err != nil {
+		t.Errorf("unexpected error without strict mode %v", err)
+	}
+}
@@ -0,0 +1,211 @@
+package evaluator
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/salleaffaire/ynt/ast"
+	"github.com/salleaffaire/ynt/token"
+)
+
+// durationUnits are the units durations can be output in as numbers.
+var durationUnits = map[string]time.Duration{
+	"ns": time.Nanosecond,
+	"us": time.Microsecond,
+	"ms": time.Millisecond,
+	"s":  time.Second,
+	"m":  time.Minute,
+	"h":  time.Hour,
+}
+
+// WithDurationUnit makes durations output as numbers of unit, one of ns, us,
+// ms, s, m and h, instead of strings such as "1h30m0s". Evaluation fails with
+// any other unit.
+func WithDurationUnit(unit string) Option {
+	return func(e *Evaluator) {
+		e.durationUnit = unit
+	}
+}
+
+// WithByteSizeUnit makes byte sizes output as numbers of unit, such as MiB or
+// GB, instead of numbers of bytes. Evaluation fails with an unknown unit.
+func WithByteSizeUnit(unit string) Option {
+	return func(e *Evaluator) {
+		e.byteSizeUnit = unit
+	}
+}
+
+// WithTimestampFormat makes timestamps output in the Go time layout, or as
+// numbers of seconds since the Unix epoch when layout is "unix", instead of
+// RFC 3339 strings. Timestamps are output in UTC either way.
+func WithTimestampFormat(layout string) Option {
+	return func(e *Evaluator) {
+		e.timestampFormat = layout
+	}
+}
+
+// checkUnits returns an error when the units of the output are unknown.
+func (e *Evaluator) checkUnits() error {
+	if _, ok := durationUnits[e.durationUnit]; e.durationUnit != "" && !ok {
+		return fmt.Errorf("Error: unknown duration unit %s", e.durationUnit)
+	}
+	if _, ok := ast.ByteSizeUnits[e.byteSizeUnit]; e.byteSizeUnit != "" && !ok {
+		return fmt.Errorf("Error: unknown byte size unit %s", e.byteSizeUnit)
+	}
+	return nil
+}
+
+// encode returns the value that v, a duration, a byte size, a timestamp or a
+// regex, is output as. Other values are output as they are.
+func (e *Evaluator) encode(v ast.Value) (ast.Value, error) {
+	switch v := v.(type) {
+	case *ast.DurationValue:
+		if e.durationUnit == "" {
+			return newString(v.Token, v.Value.String()), nil
+		}
+		return newNumber(v.Token, float64(v.Value)/float64(durationUnits[e.durationUnit])), nil
+
+	case *ast.ByteSizeValue:
+		if e.byteSizeUnit == "" {
+			return newNumber(v.Token, float64(v.Value)), nil
+		}
+		return newNumber(v.Token, float64(v.Value)/float64(ast.ByteSizeUnits[e.byteSizeUnit])), nil
+
+	case *ast.TimestampValue:
+		switch e.timestampFormat {
+		case "":
+			return newString(v.Token, v.Value.UTC().Format(time.RFC3339Nano)), nil
+		case "unix":
+			return newNumber(v.Token, float64(v.Value.UnixNano())/float64(time.Second)), nil
+		}
+		return newString(v.Token, v.Value.UTC().Format(e.timestampFormat)), nil
+
+	case *ast.RegexValue:
+		return newString(v.Token, v.Regexp.String()), nil
+	}
+
+	return v, nil
+}
+
+func newDuration(tok token.Token, d time.Duration) *ast.DurationValue {
+	return &ast.DurationValue{
+		Token: token.Token{Type: token.DURATION, Literal: d.String(), Line: tok.Line, Column: tok.Column},
+		Value: d,
+	}
+}
+
+func newByteSize(tok token.Token, n int64) *ast.ByteSizeValue {
+	return &ast.ByteSizeValue{
+		Token: token.Token{Type: token.BYTESIZE, Literal: ast.FormatByteSize(n), Line: tok.Line, Column: tok.Column},
+		Value: n,
+	}
+}
+
+func newTimestamp(tok token.Token, t time.Time) *ast.TimestampValue {
+	return &ast.TimestampValue{
+		Token: token.Token{Type: token.TIMESTAMP, Literal: t.Format(time.RFC3339Nano), Line: tok.Line, Column: tok.Column},
+		Value: t,
+	}
+}
+
+// addUnits adds durations to durations and timestamps, and byte sizes to byte
+// sizes. ok is false for other operands.
+func addUnits(tok token.Token, left, right ast.Value) (ast.Value, bool) {
+	switch l := left.(type) {
+	case *ast.DurationValue:
+		switch r := right.(type) {
+		case *ast.DurationValue:
+			return newDuration(tok, l.Value+r.Value), true
+		case *ast.TimestampValue:
+			return newTimestamp(tok, r.Value.Add(l.Value)), true
+		}
+	case *ast.TimestampValue:
+		if r, ok := right.(*ast.DurationValue); ok {
+			return newTimestamp(tok, l.Value.Add(r.Value)), true
+		}
+	case *ast.ByteSizeValue:
+		if r, ok := right.(*ast.ByteSizeValue); ok {
+			return newByteSize(tok, l.Value+r.Value), true
+		}
+	}
+	return nil, false
+}
+
+// evalUnitInfixExpression evaluates the operators other than + and == on
+// durations, byte sizes and timestamps: comparisons between values of the
+// same type, subtraction, and scaling by a number. ok is false for other
+// operands.
+func evalUnitInfixExpression(ie *ast.InfixExpression, left, right ast.Value) (ast.Value, bool, error) {
+	switch ie.Operator {
+	case "<", ">", "<=", ">=":
+		if typeName(left) != typeName(right) {
+			return nil, false, nil
+		}
+		less, ok := lessThan(left, right)
+		if !ok {
+			return nil, false, nil
+		}
+		greater, _ := lessThan(right, left)
+		switch ie.Operator {
+		case "<":
+			return newBoolean(ie.Token, less), true, nil
+		case ">":
+			return newBoolean(ie.Token, greater), true, nil
+		case "<=":
+			return newBoolean(ie.Token, !greater), true, nil
+		}
+		return newBoolean(ie.Token, !less), true, nil
+
+	case "-":
+		switch l := left.(type) {
+		case *ast.DurationValue:
+			if r, ok := right.(*ast.DurationValue); ok {
+				return newDuration(ie.Token, l.Value-r.Value), true, nil
+			}
+		case *ast.ByteSizeValue:
+			if r, ok := right.(*ast.ByteSizeValue); ok {
+				return newByteSize(ie.Token, l.Value-r.Value), true, nil
+			}
+		case *ast.TimestampValue:
+			switch r := right.(type) {
+			case *ast.DurationValue:
+				return newTimestamp(ie.Token, l.Value.Add(-r.Value)), true, nil
+			case *ast.TimestampValue:
+				return newDuration(ie.Token, l.Value.Sub(r.Value)), true, nil
+			}
+		}
+
+	case "*":
+		if _, ok := left.(*ast.NumberValue); ok {
+			left, right = right, left
+		}
+		if n, ok := right.(*ast.NumberValue); ok {
+			switch l := left.(type) {
+			case *ast.DurationValue:
+				return newDuration(ie.Token, time.Duration(float64(l.Value)*n.Value)), true, nil
+			case *ast.ByteSizeValue:
+				return newByteSize(ie.Token, int64(float64(l.Value)*n.Value)), true, nil
+			}
+		}
+
+	case "/":
+		n, ok := right.(*ast.NumberValue)
+		if !ok {
+			return nil, false, nil
+		}
+		switch l := left.(type) {
+		case *ast.DurationValue:
+			if n.Value == 0 {
+				return nil, true, newError(ie.Token, "division by zero")
+			}
+			return newDuration(ie.Token, time.Duration(float64(l.Value)/n.Value)), true, nil
+		case *ast.ByteSizeValue:
+			if n.Value == 0 {
+				return nil, true, newError(ie.Token, "division by zero")
+			}
+			return newByteSize(ie.Token, int64(float64(l.Value)/n.Value)), true, nil
+		}
+	}
+
+	return nil, false, nil
+}
@@ -0,0 +1,86 @@
+package evaluator
+
+import (
+	"testing"
+)
+
+func TestUnits(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{a: 1h30m + 15m, b: 2 * 30s, c: 1m / 4, d: -5s}`, `{"a":"1h45m0s", "b":"1m0s", "c":"15s", "d":"-5s"}`},
+		{`{a: 512MiB + 512MiB, b: 1GB - 1MB, c: 1KiB * 2}`, `{"a":1073741824, "b":999000000, "c":2048}`},
+		{`{a: 2026-01-01T00:00:00Z + 36h, b: 2026-01-02T00:00:00Z - 2026-01-01T12:00:00+02:00}`, `{"a":"2026-01-02T12:00:00Z", "b":"14h0m0s"}`},
+		{`{a: 90s > 1m, b: 1KB < 1KiB, c: 1m == 60s, d: 2026-01-01T00:00:00Z <= 2025-12-31T23:59:59Z}`, `{"a":true, "b":true, "c":true, "d":false}`},
+		{`sort([2m, 30s, 1h])`, `["30s", "2m0s", "1h0m0s"]`},
+		{`{timeout: duration & >=1s & <=1m} + {timeout: 30s}`, `{"timeout":"30s"}`},
+	}
+
+	for _, tt := range tests {
+		evaluated, err := New().EvalDocument(parse(t, tt.input))
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", tt.input, err)
+			continue
+		}
+		if evaluated.String() != tt.expected {
+			t.Errorf("%q: expected=%q, got=%q", tt.input, tt.expected, evaluated.String())
+		}
+	}
+}
+
+func TestUnitOutput(t *testing.T) {
+	input := `{d: 90s, b: 3MiB, t: 2026-01-01T01:00:00+01:00}`
+
+	tests := []struct {
+		options  []Option
+		expected string
+	}{
+		{nil, `{"d":"1m30s", "b":3145728, "t":"2026-01-01T00:00:00Z"}`},
+		{
+			[]Option{WithDurationUnit("s"), WithByteSizeUnit("KiB"), WithTimestampFormat("unix")},
+			`{"d":90, "b":3072, "t":1767225600}`,
+		},
+		{[]Option{WithDurationUnit("m"), WithTimestampFormat("2006-01-02")}, `{"d":1.5, "b":3145728, "t":"2026-01-01"}`},
+		{[]Option{WithTimestampFormat("2006-01-02T15:04")}, `{"d":"1m30s", "b":3145728, "t":"2026-01-01T00:00"}`},
+	}
+
+	for _, tt := range tests {
+		evaluated, err := New(tt.options...).EvalDocument(parse(t, input))
+		if err != nil {
+			t.Errorf("unexpected error %v", err)
+			continue
+		}
+		if evaluated.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, evaluated.String())
+		}
+	}
+}
+
+func TestUnitErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		options  []Option
+		expected string
+	}{
+		{`{a: 1s + 1}`, nil, "Error: unknown operator: duration + number - line 1 column 8"},
+		{`{a: 1s < 1KB}`, nil, "Error: unknown operator: duration < bytesize - line 1 column 8"},
+		{`{a: 1s / 0}`, nil, "Error: division by zero - line 1 column 8"},
+		{`{timeout: duration & <=1m & 2m}`, nil, "Error: invalid value 2m: does not satisfy <=1m - line 1 column 27"},
+		{`{a: 1s}`, []Option{WithDurationUnit("d")}, "Error: unknown duration unit d"},
+		{`{a: 1KB}`, []Option{WithByteSizeUnit("kb")}, "Error: unknown byte size unit kb"},
+		{`{a: 1}`, []Option{WithDurationUnit("parsecs")}, "Error: unknown duration unit parsecs"},
+		{`{a: 1}`, []Option{WithByteSizeUnit("kb")}, "Error: unknown byte size unit kb"},
+	}
+
+	for _, tt := range tests {
+		_, err := New(tt.options...).EvalDocument(parse(t, tt.input))
+		if err == nil {
+			t.Errorf("%q: expected an error", tt.input)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("%q: expected=%q, got=%q", tt.input, tt.expected, err.Error())
+		}
+	}
+}
@@ -1,7 +1,10 @@
 package lexer
 
 import (
+	"errors"
 	"fmt"
+	"regexp"
+	"strings"
 
 	"github.com/salleaffaire/ynt/token"
 )
@@ -19,6 +22,7 @@ type Lexer struct {
 	Errors []string
 
 	lineNumber int
+	lineStart  int
 
 	// Tokens
 	Tokens         []token.Token
@@ -27,6 +31,16 @@ type Lexer struct {
 }
 
 func New(input string) *Lexer {
+	l, err := Tokenize(input)
+	if err != nil {
+		fmt.Println(err)
+		return nil
+	}
+	return l
+}
+
+// Tokenize is like New but returns the lexer errors instead of printing them.
+func Tokenize(input string) (*Lexer, error) {
 	l := &Lexer{input: input}
 	l.tokenIndex = 0
 	l.lineNumber = 1
@@ -35,35 +49,27 @@ func New(input string) *Lexer {
 
 	tok := l.nextToken()
 	if tok.Type == token.ILLEGAL {
-		l.printLexerErrors()
-		return nil
+		return nil, errors.New(strings.Join(l.Errors, "\n"))
 	}
 	l.Tokens = append(l.Tokens, tok)
 
 	for tok.Type != token.EOF {
 		tok = l.nextToken()
 		if tok.Type == token.ILLEGAL {
-			l.printLexerErrors()
-			return nil
+			return nil, errors.New(strings.Join(l.Errors, "\n"))
 		}
 		l.Tokens = append(l.Tokens, tok)
 	}
 
 	l.numberOfTokens = len(l.Tokens)
 
-	return l
+	return l, nil
 }
 
 func (l *Lexer) Error(message string) {
 	l.Errors = append(l.Errors, message)
 }
 
-func (l *Lexer) printLexerErrors() {
-	for _, e := range l.Errors {
-		fmt.Println(e)
-	}
-}
-
 func (l *Lexer) readChar() {
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
@@ -88,18 +94,92 @@ func (l *Lexer) NextToken() token.Token {
 	return tok
 }
 
-func (l *Lexer) nextToken() token.Token {
-	var tok token.Token
+func (l *Lexer) nextToken() (tok token.Token) {
 
 	// fmt.Println("l.ch before white space: ", string(l.ch))
 	l.skipWhitespace()
 	// fmt.Println("l.ch after white space: ", string(l.ch))
 
+	line, column := l.lineNumber, l.position-l.lineStart+1
+	defer func() {
+		tok.Line = line
+		tok.Column = column
+	}()
+
 	switch l.ch {
 	case ':':
-		tok = newToken(token.COLON, l.ch)
+		if l.peekChar() == ':' {
+			tok = l.newTwoCharToken(token.DOUBLE_COLON)
+		} else {
+			tok = newToken(token.COLON, l.ch)
+		}
 	case ',':
 		tok = newToken(token.COMMA, l.ch)
+	case '.':
+		if l.peekChar() == '.' && l.readPosition+1 < len(l.input) && l.input[l.readPosition+1] == '.' {
+			l.readChar()
+			l.readChar()
+			tok = token.Token{Type: token.ELLIPSIS, Literal: "..."}
+		} else {
+			tok = newToken(token.DOT, l.ch)
+		}
+	case '(':
+		tok = newToken(token.LPAREN, l.ch)
+	case ')':
+		tok = newToken(token.RPAREN, l.ch)
+	case '+':
+		tok = newToken(token.PLUS, l.ch)
+	case '*':
+		tok = newToken(token.ASTERISK, l.ch)
+	case '/':
+		tok = newToken(token.SLASH, l.ch)
+	case '%':
+		tok = newToken(token.PERCENT, l.ch)
+	case '!':
+		if l.peekChar() == '=' {
+			tok = l.newTwoCharToken(token.NOT_EQ)
+		} else {
+			tok = newToken(token.BANG, l.ch)
+		}
+	case '=':
+		if l.peekChar() == '=' {
+			tok = l.newTwoCharToken(token.EQ)
+		} else {
+			tok = newToken(token.ASSIGN, l.ch)
+		}
+	case '<':
+		if l.peekChar() == '=' {
+			tok = l.newTwoCharToken(token.LT_EQ)
+		} else {
+			tok = newToken(token.LT, l.ch)
+		}
+	case '>':
+		if l.peekChar() == '=' {
+			tok = l.newTwoCharToken(token.GT_EQ)
+		} else {
+			tok = newToken(token.GT, l.ch)
+		}
+	case '&':
+		if l.peekChar() == '&' {
+			tok = l.newTwoCharToken(token.AND)
+		} else {
+			tok = newToken(token.AMPERSAND, l.ch)
+		}
+	case '|':
+		if l.peekChar() == '|' {
+			tok = l.newTwoCharToken(token.OR)
+		} else {
+			tok = newToken(token.PIPE, l.ch)
+		}
+	case '?':
+		switch l.peekChar() {
+		case '.':
+			tok = l.newTwoCharToken(token.QUESTION_DOT)
+		case '?':
+			tok = l.newTwoCharToken(token.COALESCE)
+		default:
+			tok = l.illegal()
+		}
 	case '{':
 		tok = newToken(token.LBRACE, l.ch)
 	case '}':
@@ -120,21 +200,35 @@ func (l *Lexer) nextToken() token.Token {
 		tok.Type = token.EOF
 
 	default:
-		if isLetter(l.ch) {
+		if l.ch == 'r' && l.peekChar() == 'e' && l.readPosition+1 < len(l.input) && l.input[l.readPosition+1] == '"' {
+			l.readChar()
+			l.readChar()
+			tok.Type = token.REGEX
+			tok.Literal = l.readRegex()
+			if len(l.Errors) != 0 {
+				tok.Type = token.ILLEGAL
+			}
+		} else if isLetter(l.ch) {
 			tok.Literal = l.readIdentifier()
 			tok.Type = token.LookupIdent(tok.Literal)
 			return tok
+		} else if l.ch == '-' && (!isDigit(l.peekChar()) || l.followsOperand()) {
+			tok = newToken(token.MINUS, l.ch)
 		} else if isDigit(l.ch) || l.ch == '-' {
+			if tok.Literal = l.readTimestamp(); tok.Literal != "" {
+				tok.Type = token.TIMESTAMP
+				return tok
+			}
 			tok.Type = token.NUMBER
 			tok.Literal = l.readNumber()
 			if len(l.Errors) != 0 {
 				tok.Type = token.ILLEGAL
+			} else if isLetter(l.ch) {
+				tok.Literal, tok.Type = l.readQuantity(tok.Literal)
 			}
 			return tok
 		} else {
-			mes := fmt.Sprintf("Error: invalid caracter %c - line %d", l.ch, l.lineNumber)
-			l.Error(mes)
-			tok = newToken(token.ILLEGAL, l.ch)
+			tok = l.illegal()
 		}
 	}
 
@@ -142,6 +236,35 @@ func (l *Lexer) nextToken() token.Token {
 	return tok
 }
 
+func (l *Lexer) illegal() token.Token {
+	mes := fmt.Sprintf("Error: invalid caracter %c - line %d", l.ch, l.lineNumber)
+	l.Error(mes)
+	return newToken(token.ILLEGAL, l.ch)
+}
+
+// newTwoCharToken consumes the current character and returns a token made
+// of it and the one that follows.
+func (l *Lexer) newTwoCharToken(tokenType token.TokenType) token.Token {
+	ch := l.ch
+	l.readChar()
+	return token.Token{Type: tokenType, Literal: string(ch) + string(l.ch)}
+}
+
+// followsOperand reports whether the last token read can end an operand, in
+// which case a '-' is the subtraction operator rather than a number sign.
+func (l *Lexer) followsOperand() bool {
+	if len(l.Tokens) == 0 {
+		return false
+	}
+	switch l.Tokens[len(l.Tokens)-1].Type {
+	case token.NUMBER, token.STRING, token.REGEX, token.IDENT, token.TRUE, token.FALSE, token.NULL,
+		token.DURATION, token.BYTESIZE, token.TIMESTAMP,
+		token.RPAREN, token.RBRACKET, token.RBRACE:
+		return true
+	}
+	return false
+}
+
 func (l *Lexer) readString() string {
 	position := l.position + 1
 
@@ -177,13 +300,36 @@ func (l *Lexer) readString() string {
 	return l.input[position:l.position]
 }
 
+// readRegex reads the pattern of a regex literal re"...". Backslashes are kept
+// for the regex to interpret, and only \" does not end the pattern.
+func (l *Lexer) readRegex() string {
+	position := l.position + 1
+
+	for {
+		l.readChar()
+		if l.ch == '"' {
+			break
+		}
+		if l.ch == 0 {
+			mes := fmt.Sprintf("Error: unexpected end of file in regex %s - line %d position %d",
+				l.input[position:l.position], l.lineNumber, l.position)
+			l.Error(mes)
+			break
+		}
+		if l.ch == '\\' && l.peekChar() != 0 {
+			l.readChar()
+		}
+	}
+	return l.input[position:l.position]
+}
+
 func newToken(tokenType token.TokenType, ch byte) token.Token {
 	return token.Token{Type: tokenType, Literal: string(ch)}
 }
 
 func (l *Lexer) readIdentifier() string {
 	position := l.position
-	for isLetter(l.ch) {
+	for isLetter(l.ch) || isDigit(l.ch) {
 		l.readChar()
 	}
 	return l.input[position:l.position]
@@ -257,6 +403,36 @@ func (l *Lexer) readNumber() string {
 	return l.input[position:l.position]
 }
 
+var timestamp = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:\d{2})`)
+
+// readTimestamp reads an RFC 3339 timestamp, or returns "" when the input is
+// not one. A date alone is a subtraction.
+func (l *Lexer) readTimestamp() string {
+	if !isDigit(l.ch) {
+		return ""
+	}
+	lit := timestamp.FindString(l.input[l.position:])
+	for i := 0; i < len(lit); i++ {
+		l.readChar()
+	}
+	return lit
+}
+
+// readQuantity reads the rest of a number followed by a unit: a duration such
+// as 1h30m, or a byte size, whose unit ends with B, such as 512MiB.
+func (l *Lexer) readQuantity(number string) (string, token.TokenType) {
+	position := l.position
+	for isLetter(l.ch) || isDigit(l.ch) || l.ch == '.' {
+		l.readChar()
+	}
+	lit := number + l.input[position:l.position]
+
+	if strings.HasSuffix(lit, "B") {
+		return lit, token.BYTESIZE
+	}
+	return lit, token.DURATION
+}
+
 func isLetter(ch byte) bool {
 	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
 }
@@ -271,8 +447,9 @@ func isNonZeroDigit(ch byte) bool {
 
 func (l *Lexer) skipWhitespace() {
 	for l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r' {
-		if l.ch == '\n' || l.ch == '\r' {
+		if l.ch == '\n' {
 			l.lineNumber += 1
+			l.lineStart = l.readPosition
 		}
 		l.readChar()
 	}
@@ -166,3 +166,167 @@ func TestNextTokenNumber(t *testing.T) {
 
 	}
 }
+
+func TestNextTokenOperators(t *testing.T) {
+	input := `[for x in xs: x - -1 if !(x >= 2) && x != 3 || x.y <= 1] {a:: 1} a?.b ?? null`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.LBRACKET, "["},
+		{token.FOR, "for"},
+		{token.IDENT, "x"},
+		{token.IN, "in"},
+		{token.IDENT, "xs"},
+		{token.COLON, ":"},
+		{token.IDENT, "x"},
+		{token.MINUS, "-"},
+		{token.NUMBER, "-1"},
+		{token.IF, "if"},
+		{token.BANG, "!"},
+		{token.LPAREN, "("},
+		{token.IDENT, "x"},
+		{token.GT_EQ, ">="},
+		{token.NUMBER, "2"},
+		{token.RPAREN, ")"},
+		{token.AND, "&&"},
+		{token.IDENT, "x"},
+		{token.NOT_EQ, "!="},
+		{token.NUMBER, "3"},
+		{token.OR, "||"},
+		{token.IDENT, "x"},
+		{token.DOT, "."},
+		{token.IDENT, "y"},
+		{token.LT_EQ, "<="},
+		{token.NUMBER, "1"},
+		{token.RBRACKET, "]"},
+		{token.LBRACE, "{"},
+		{token.IDENT, "a"},
+		{token.DOUBLE_COLON, "::"},
+		{token.NUMBER, "1"},
+		{token.RBRACE, "}"},
+		{token.IDENT, "a"},
+		{token.QUESTION_DOT, "?."},
+		{token.IDENT, "b"},
+		{token.COALESCE, "??"},
+		{token.NULL, "null"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestNextTokenUnits(t *testing.T) {
+	input := `1h30m 512MiB 1.5GB 2026-01-01T00:00:00Z 2026-12-31 5-3`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.DURATION, "1h30m"},
+		{token.BYTESIZE, "512MiB"},
+		{token.BYTESIZE, "1.5GB"},
+		{token.TIMESTAMP, "2026-01-01T00:00:00Z"},
+		{token.NUMBER, "2026"},
+		{token.MINUS, "-"},
+		{token.NUMBER, "12"},
+		{token.MINUS, "-"},
+		{token.NUMBER, "31"},
+		{token.NUMBER, "5"},
+		{token.MINUS, "-"},
+		{token.NUMBER, "3"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestNextTokenRegex(t *testing.T) {
+	input := `matches(s, re"^\d+\"$") + re`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENT, "matches"},
+		{token.LPAREN, "("},
+		{token.IDENT, "s"},
+		{token.COMMA, ","},
+		{token.REGEX, `^\d+\"$`},
+		{token.RPAREN, ")"},
+		{token.PLUS, "+"},
+		{token.IDENT, "re"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestTokenPosition(t *testing.T) {
+	tests := []struct {
+		line   int
+		column int
+	}{
+		{1, 1},
+		{2, 3},
+		{2, 7},
+		{2, 9},
+		{3, 1},
+	}
+
+	for _, input := range []string{"{\n  \"a\" : 1\n}", "{\r\n  \"a\" : 1\r\n}"} {
+		l := New(input)
+
+		for i, tt := range tests {
+			tok := l.NextToken()
+
+			if tok.Line != tt.line || tok.Column != tt.column {
+				t.Fatalf("%q: tests[%d] - position wrong. expected=%d:%d, got=%d:%d",
+					input, i, tt.line, tt.column, tok.Line, tok.Column)
+			}
+		}
+	}
+}
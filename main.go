@@ -1,13 +1,193 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 
+	"github.com/salleaffaire/ynt/ast"
+	"github.com/salleaffaire/ynt/evaluator"
 	"github.com/salleaffaire/ynt/repl"
 )
 
 var version = "0.0.1"
 
+// externalFlag collects name=value flags into options binding external
+// arguments.
+type externalFlag struct {
+	options *[]evaluator.Option
+	code    bool
+}
+
+func (f externalFlag) String() string {
+	return ""
+}
+
+func (f externalFlag) Set(s string) error {
+	i := strings.Index(s, "=")
+	if i <= 0 {
+		return fmt.Errorf("expected name=value, got %q", s)
+	}
+
+	if f.code {
+		*f.options = append(*f.options, evaluator.WithExtCode(s[:i], s[i+1:]))
+	} else {
+		*f.options = append(*f.options, evaluator.WithExtVar(s[:i], s[i+1:]))
+	}
+	return nil
+}
+
 func main() {
-	repl.Start(os.Stdin, os.Stdout)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: ynt [file]\n\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "Evaluates a JSON+ file, or starts a REPL without one.\n")
+		flag.PrintDefaults()
+	}
+	timeout := flag.Duration("timeout", 0, "stop the evaluation after `duration`, 0 for no limit")
+	maxSteps := flag.Int("max-steps", 0, "stop the evaluation after `n` steps, 0 for no limit")
+	maxOutput := flag.Int("max-output", 0, "fail when the output is longer than `n` bytes, 0 for no limit")
+	var externals []evaluator.Option
+	flag.Var(externalFlag{options: &externals}, "V", "bind the external argument `name=value` to the string value")
+	flag.Var(externalFlag{options: &externals, code: true}, "C", "bind the external argument `name=code` to the value of the JSON+ code")
+	var includes []string
+	flag.Func("I", "look for imports in `dir`, before the directories of YNT_PATH", func(s string) error {
+		includes = append(includes, s)
+		return nil
+	})
+	var profiles []string
+	flag.Func("profile", "apply the overlays of the `names` profiles, separated by commas", func(s string) error {
+		profiles = append(profiles, strings.Split(s, ",")...)
+		return nil
+	})
+	sources := flag.Bool("sources", false, "print the profile that set each field to the standard error")
+	var explain []string
+	flag.Func("explain", "print where the output value at `path` comes from to the standard error", func(s string) error {
+		explain = append(explain, s)
+		return nil
+	})
+	secretsDir := flag.String("secrets", "", "read secret(name) from the file name of `dir`")
+	secretsEnv := flag.String("secrets-env", "", "read secret(name) from the environment variable PREFIX_NAME, with `prefix` PREFIX")
+	redact := flag.Bool("redact", false, "print the secrets of the output as "+ast.Redacted)
+	durationUnit := flag.String("duration-unit", "", "print durations as numbers of `unit` (ns, us, ms, s, m or h) instead of strings")
+	byteSizeUnit := flag.String("bytesize-unit", "", "print byte sizes as numbers of `unit` (such as KB or MiB) instead of bytes")
+	timestampFormat := flag.String("timestamp-format", "", "print timestamps in the Go time `layout`, or as seconds with unix, instead of RFC 3339, in UTC")
+	strict := flag.Bool("strict", false, "fail when merging sets a field to conflicting values, unless the field is declared with key!: value")
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		repl.Start(os.Stdin, os.Stdout)
+		return
+	}
+
+	ctx := context.Background()
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+
+	options := append(externals, evaluator.WithMaxSteps(*maxSteps), evaluator.WithMaxOutput(*maxOutput),
+		evaluator.WithProfiles(profiles...), evaluator.WithDurationUnit(*durationUnit),
+		evaluator.WithByteSizeUnit(*byteSizeUnit), evaluator.WithTimestampFormat(*timestampFormat))
+	dirs, err := searchPath(append(includes, filepath.SplitList(os.Getenv("YNT_PATH"))...))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	options = append(options, evaluator.WithSearchPath(dirs...))
+	if len(explain) > 0 {
+		options = append(options, evaluator.WithProvenance())
+	}
+	if *strict {
+		options = append(options, evaluator.WithStrict())
+	}
+	switch {
+	case *secretsDir != "" && *secretsEnv != "":
+		fmt.Fprintln(os.Stderr, "Error: -secrets and -secrets-env cannot be used together")
+		os.Exit(2)
+	case *secretsDir != "":
+		options = append(options, evaluator.WithSecrets(evaluator.DirSecrets{FS: os.DirFS(*secretsDir)}))
+	case *secretsEnv != "":
+		options = append(options, evaluator.WithSecrets(evaluator.EnvSecrets{Prefix: *secretsEnv}))
+	}
+	if err := evalFile(ctx, flag.Arg(0), options, *sources, *redact, explain); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// searchPath returns dirs as directories of the file system rooted at /.
+func searchPath(dirs []string) ([]string, error) {
+	result := []string{}
+	for _, dir := range dirs {
+		if dir == "" {
+			continue
+		}
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, strings.TrimPrefix(filepath.ToSlash(abs), "/"))
+	}
+	return result, nil
+}
+
+// osPath returns the path of the operating system of the file named name in
+// the file system rooted at /, relative to the working directory when it is
+// inside it.
+func osPath(name string) string {
+	p := filepath.FromSlash("/" + name)
+	if wd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(wd, p); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return rel
+		}
+	}
+	return p
+}
+
+func evalFile(ctx context.Context, name string, options []evaluator.Option, sources, redact bool, explain []string) error {
+	abs, err := filepath.Abs(name)
+	if err != nil {
+		return err
+	}
+
+	// Imports can go anywhere, so the file system is rooted at /
+	e := evaluator.New(append(options, evaluator.WithFS(os.DirFS("/")), evaluator.WithFileNames(osPath))...)
+	value, err := e.EvalFileContext(ctx, strings.TrimPrefix(filepath.ToSlash(abs), "/"))
+	if err != nil {
+		return err
+	}
+
+	if redact {
+		value = ast.Redact(value)
+	}
+	fmt.Println(value.String())
+
+	if sources {
+		paths := []string{}
+		for path := range e.ProfileSources() {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		for _, path := range paths {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", path, e.ProfileSources()[path])
+		}
+	}
+
+	for _, path := range explain {
+		steps, err := e.Explain(path)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "%s:\n", path)
+		for _, step := range steps {
+			fmt.Fprintf(os.Stderr, "\t%s\n", step)
+		}
+	}
+
+	return nil
 }
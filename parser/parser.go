@@ -1,21 +1,78 @@
 package parser
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"regexp"
+	"regexp/syntax"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/salleaffaire/ynt/ast"
 	"github.com/salleaffaire/ynt/lexer"
 	"github.com/salleaffaire/ynt/token"
 )
 
+const (
+	_ int = iota
+	LOWEST
+	DISJUNCTION // |
+	CONJUNCTION // &
+	COALESCE    // ??
+	OR          // ||
+	AND         // &&
+	EQUALS      // ==
+	LESSGREATER // > or <
+	SUM         // +
+	PRODUCT     // *
+	PREFIX      // -X or !X
+	CALL        // f(x), a.b or a[i]
+)
+
+var precedences = map[token.TokenType]int{
+	token.PIPE:         DISJUNCTION,
+	token.AMPERSAND:    CONJUNCTION,
+	token.COALESCE:     COALESCE,
+	token.OR:           OR,
+	token.AND:          AND,
+	token.EQ:           EQUALS,
+	token.NOT_EQ:       EQUALS,
+	token.LT:           LESSGREATER,
+	token.GT:           LESSGREATER,
+	token.LT_EQ:        LESSGREATER,
+	token.GT_EQ:        LESSGREATER,
+	token.PLUS:         SUM,
+	token.MINUS:        SUM,
+	token.ASTERISK:     PRODUCT,
+	token.SLASH:        PRODUCT,
+	token.PERCENT:      PRODUCT,
+	token.DOT:          CALL,
+	token.QUESTION_DOT: CALL,
+	token.LBRACKET:     CALL,
+	token.LPAREN:       CALL,
+}
+
+type (
+	prefixParseFn func() ast.Value
+	infixParseFn  func(ast.Value) ast.Value
+)
+
 type Parser struct {
-	l *lexer.Lexer
+	l   *lexer.Lexer
+	ctx context.Context
 
 	Errors []string
 
 	curToken  token.Token
 	peekToken token.Token
+
+	prefixParseFns map[token.TokenType]prefixParseFn
+	infixParseFns  map[token.TokenType]infixParseFn
+
+	// The object literals being parsed, innermost last
+	objects []*ast.ObjectValue
 }
 
 func (p *Parser) Error(message string) {
@@ -34,6 +91,42 @@ func New(l *lexer.Lexer) *Parser {
 		Errors: []string{},
 	}
 
+	p.prefixParseFns = make(map[token.TokenType]prefixParseFn)
+	p.registerPrefix(token.NUMBER, p.parseIntegerValue)
+	p.registerPrefix(token.STRING, p.parseStringValue)
+	p.registerPrefix(token.REGEX, p.parseRegexValue)
+	p.registerPrefix(token.DURATION, p.parseDurationValue)
+	p.registerPrefix(token.BYTESIZE, p.parseByteSizeValue)
+	p.registerPrefix(token.TIMESTAMP, p.parseTimestampValue)
+	p.registerPrefix(token.TRUE, p.parseBooleanValue)
+	p.registerPrefix(token.FALSE, p.parseBooleanValue)
+	p.registerPrefix(token.NULL, p.parseNullValue)
+	p.registerPrefix(token.SELF, p.parseSelfExpression)
+	p.registerPrefix(token.SUPER, p.parseSelfExpression)
+	p.registerPrefix(token.LBRACKET, p.parseArrayValue)
+	p.registerPrefix(token.LBRACE, p.parseObjectValue)
+	p.registerPrefix(token.IDENT, p.parseIdentifier)
+	p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
+	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
+	p.registerPrefix(token.BANG, p.parsePrefixExpression)
+	p.registerPrefix(token.IF, p.parseIfExpression)
+	p.registerPrefix(token.TRY, p.parseTryExpression)
+	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
+	p.registerPrefix(token.IMPORT, p.parseImportExpression)
+	p.registerPrefix(token.ASTERISK, p.parseDefaultExpression)
+	for _, tt := range []token.TokenType{token.LT, token.GT, token.LT_EQ, token.GT_EQ, token.NOT_EQ} {
+		p.registerPrefix(tt, p.parseBoundExpression)
+	}
+
+	p.infixParseFns = make(map[token.TokenType]infixParseFn)
+	for tt := range precedences {
+		p.registerInfix(tt, p.parseInfixExpression)
+	}
+	p.registerInfix(token.DOT, p.parseMemberExpression)
+	p.registerInfix(token.QUESTION_DOT, p.parseMemberExpression)
+	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
+	p.registerInfix(token.LPAREN, p.parseCallExpression)
+
 	p.nextToken()
 	p.nextToken()
 
@@ -46,43 +139,316 @@ func (p *Parser) nextToken() {
 }
 
 func (p *Parser) ParseDocument() *ast.Document {
+	document, err := p.Parse()
+	if err != nil {
+		p.printParserErrors()
+		return nil
+	}
+	return document
+}
+
+// Parse is like ParseDocument but returns the parser errors instead of
+// printing them.
+func (p *Parser) Parse() (*ast.Document, error) {
+	return p.ParseContext(context.Background())
+}
+
+// ParseContext is like Parse but stops when ctx is done, with an error wrapping
+// the one of ctx.
+func (p *Parser) ParseContext(ctx context.Context) (*ast.Document, error) {
+	p.ctx = ctx
+	document, err := p.parseDocument()
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("Error: parsing stopped: %w", ctx.Err())
+	}
+	return document, err
+}
+
+func (p *Parser) parseDocument() (*ast.Document, error) {
 	document := &ast.Document{}
 	document.Values = []ast.Value{}
 
 	for p.curToken.Type != token.EOF {
+		if p.curTokenIs(token.ASSERT) {
+			assertion := p.parseAssertion()
+			if assertion == nil {
+				return nil, errors.New(strings.Join(p.Errors, "\n"))
+			}
+			document.Assertions = append(document.Assertions, assertion)
+			p.nextToken()
+			continue
+		}
+		if p.curTokenIs(token.PARAM) {
+			param := p.parseParam()
+			if param == nil {
+				return nil, errors.New(strings.Join(p.Errors, "\n"))
+			}
+			document.Params = append(document.Params, param)
+			p.nextToken()
+			continue
+		}
+		if p.curTokenIs(token.IMPORT) {
+			// import "path" as name, or else an expression starting with
+			// import "path"
+			expression := p.parseImportExpression()
+			if expression == nil {
+				return nil, errors.New(strings.Join(p.Errors, "\n"))
+			}
+			if p.peekToken.Type == token.IDENT && p.peekToken.Literal == "as" {
+				ie := expression.(*ast.ImportExpression)
+				p.nextToken()
+				if !p.expectPeek(token.IDENT) {
+					return nil, errors.New(strings.Join(p.Errors, "\n"))
+				}
+				document.Imports = append(document.Imports, &ast.Import{
+					Token: ie.Token,
+					Path:  ie.Path,
+					Name:  &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal},
+				})
+				p.nextToken()
+				continue
+			}
+			value := p.parseInfixes(expression, LOWEST)
+			if value == nil {
+				return nil, errors.New(strings.Join(p.Errors, "\n"))
+			}
+			document.Values = append(document.Values, value)
+			p.nextToken()
+			continue
+		}
+		if p.curTokenIs(token.EXPORT) {
+			exports := p.parseExport()
+			if exports == nil {
+				return nil, errors.New(strings.Join(p.Errors, "\n"))
+			}
+			document.Exports = append(document.Exports, exports...)
+			p.nextToken()
+			continue
+		}
+		if p.curTokenIs(token.PROFILE) {
+			profile := p.parseProfile()
+			if profile == nil {
+				return nil, errors.New(strings.Join(p.Errors, "\n"))
+			}
+			document.Profiles = append(document.Profiles, profile)
+			p.nextToken()
+			continue
+		}
+
 		object := p.parseValue()
 		if object != nil {
 			document.Values = append(document.Values, object)
 		} else {
-			p.printParserErrors()
-			return nil
+			return nil, errors.New(strings.Join(p.Errors, "\n"))
 		}
 
 		p.nextToken()
 	}
 
-	return document
+	return document, nil
+}
+
+func (p *Parser) registerPrefix(tokenType token.TokenType, fn prefixParseFn) {
+	p.prefixParseFns[tokenType] = fn
+}
+
+func (p *Parser) registerInfix(tokenType token.TokenType, fn infixParseFn) {
+	p.infixParseFns[tokenType] = fn
 }
 
 func (p *Parser) parseValue() ast.Value {
-	switch p.curToken.Type {
-	case token.NUMBER:
-		return p.parseIntegerValue()
-	case token.STRING:
-		return p.parseStringValue()
-	case token.TRUE:
-		return p.parseBooleanValue()
-	case token.FALSE:
-		return p.parseBooleanValue()
-	case token.LBRACKET:
-		return p.parseArrayValue()
-	case token.LBRACE:
-		return p.parseObjectValue()
-	default:
-		msg := fmt.Sprintf("Error: unexpected token %s", p.curToken.Literal)
+	return p.parseExpression(LOWEST)
+}
+
+func (p *Parser) parseExpression(precedence int) ast.Value {
+	if p.ctx.Err() != nil {
+		return nil
+	}
+
+	prefix := p.prefixParseFns[p.curToken.Type]
+	if prefix == nil {
+		msg := fmt.Sprintf("Error: unexpected token %s - line %d column %d",
+			p.curToken.Literal, p.curToken.Line, p.curToken.Column)
 		p.Errors = append(p.Errors, msg)
 		return nil
 	}
+	return p.parseInfixes(prefix(), precedence)
+}
+
+// parseInfixes parses the operators following left that bind tighter than
+// precedence.
+func (p *Parser) parseInfixes(left ast.Value, precedence int) ast.Value {
+	for left != nil && precedence < p.peekPrecedence() {
+		// A [ starting a line is an array, not an index
+		if p.peekTokenIs(token.LBRACKET) && p.peekToken.Line != p.curToken.Line {
+			return left
+		}
+
+		infix := p.infixParseFns[p.peekToken.Type]
+		if infix == nil {
+			return left
+		}
+
+		p.nextToken()
+
+		left = infix(left)
+	}
+
+	return left
+}
+
+func (p *Parser) peekPrecedence() int {
+	if p, ok := precedences[p.peekToken.Type]; ok {
+		return p
+	}
+	return LOWEST
+}
+
+func (p *Parser) curPrecedence() int {
+	if p, ok := precedences[p.curToken.Type]; ok {
+		return p
+	}
+	return LOWEST
+}
+
+func (p *Parser) parseIdentifier() ast.Value {
+	return &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+}
+
+func (p *Parser) parseGroupedExpression() ast.Value {
+	p.nextToken()
+
+	exp := p.parseExpression(LOWEST)
+	if exp == nil {
+		return nil
+	}
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	return exp
+}
+
+func (p *Parser) parsePrefixExpression() ast.Value {
+	expression := &ast.PrefixExpression{
+		Token:    p.curToken,
+		Operator: p.curToken.Literal,
+	}
+
+	p.nextToken()
+
+	expression.Right = p.parseExpression(PREFIX)
+	if expression.Right == nil {
+		return nil
+	}
+
+	return expression
+}
+
+// parseBoundExpression parses a constraint such as >=1.
+func (p *Parser) parseBoundExpression() ast.Value {
+	expression := &ast.BoundExpression{
+		Token:    p.curToken,
+		Operator: p.curToken.Literal,
+	}
+
+	p.nextToken()
+
+	expression.Value = p.parseExpression(PREFIX)
+	if expression.Value == nil {
+		return nil
+	}
+
+	return expression
+}
+
+// parseDefaultExpression parses the *default alternative of a disjunction.
+func (p *Parser) parseDefaultExpression() ast.Value {
+	expression := &ast.DefaultExpression{Token: p.curToken}
+
+	p.nextToken()
+
+	expression.Value = p.parseExpression(PREFIX)
+	if expression.Value == nil {
+		return nil
+	}
+
+	return expression
+}
+
+func (p *Parser) parseInfixExpression(left ast.Value) ast.Value {
+	expression := &ast.InfixExpression{
+		Token:    p.curToken,
+		Operator: p.curToken.Literal,
+		Left:     left,
+	}
+
+	precedence := p.curPrecedence()
+	p.nextToken()
+	expression.Right = p.parseExpression(precedence)
+	if expression.Right == nil {
+		return nil
+	}
+
+	return expression
+}
+
+func (p *Parser) parseMemberExpression(object ast.Value) ast.Value {
+	if p.curTokenIs(token.QUESTION_DOT) && p.peekTokenIs(token.LBRACKET) {
+		tok := p.curToken
+		p.nextToken()
+		expression, ok := p.parseIndexExpression(object).(*ast.IndexExpression)
+		if !ok {
+			return nil
+		}
+		expression.Token = tok
+		expression.Optional = true
+		return expression
+	}
+
+	expression := &ast.MemberExpression{Token: p.curToken, Object: object, Optional: p.curTokenIs(token.QUESTION_DOT)}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	expression.Property = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	return expression
+}
+
+// parseIndexExpression parses left[index] and the slices left[low:high],
+// where low and high can be left out.
+func (p *Parser) parseIndexExpression(left ast.Value) ast.Value {
+	tok := p.curToken
+	p.nextToken()
+
+	var low ast.Value
+	if !p.curTokenIs(token.COLON) {
+		low = p.parseExpression(LOWEST)
+		if low == nil {
+			return nil
+		}
+		if p.peekTokenIs(token.RBRACKET) {
+			p.nextToken()
+			return &ast.IndexExpression{Token: tok, Left: left, Index: low}
+		}
+		if !p.expectPeek(token.COLON) {
+			return nil
+		}
+	}
+
+	slice := &ast.SliceExpression{Token: tok, Left: left, Low: low}
+	if p.peekTokenIs(token.RBRACKET) {
+		p.nextToken()
+		return slice
+	}
+	p.nextToken()
+	slice.High = p.parseExpression(LOWEST)
+	if slice.High == nil || !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+	return slice
 }
 
 func (p *Parser) parseIntegerValue() ast.Value {
@@ -106,11 +472,59 @@ func (p *Parser) parseStringValue() ast.Value {
 
 	lit := &ast.StringValue{Token: p.curToken}
 
-	lit.Value = p.curToken.Literal
+	lit.Value = ast.Unescape(p.curToken.Literal)
 
 	return lit
 }
 
+// parseRegexValue parses re"pattern", reporting invalid patterns.
+func (p *Parser) parseRegexValue() ast.Value {
+	re, err := regexp.Compile(p.curToken.Literal)
+	if err != nil {
+		reason := err.Error()
+		if se, ok := err.(*syntax.Error); ok {
+			reason = string(se.Code)
+		}
+		msg := fmt.Sprintf("Error: invalid regex re\"%s\": %s - line %d column %d",
+			p.curToken.Literal, reason, p.curToken.Line, p.curToken.Column)
+		p.Errors = append(p.Errors, msg)
+		return nil
+	}
+	return &ast.RegexValue{Token: p.curToken, Regexp: re}
+}
+
+func (p *Parser) parseDurationValue() ast.Value {
+	d, err := time.ParseDuration(p.curToken.Literal)
+	if err != nil {
+		msg := fmt.Sprintf("Error: invalid duration %s - line %d column %d",
+			p.curToken.Literal, p.curToken.Line, p.curToken.Column)
+		p.Errors = append(p.Errors, msg)
+		return nil
+	}
+	return &ast.DurationValue{Token: p.curToken, Value: d}
+}
+
+func (p *Parser) parseByteSizeValue() ast.Value {
+	n, err := ast.ParseByteSize(p.curToken.Literal)
+	if err != nil {
+		msg := fmt.Sprintf("Error: %v - line %d column %d", err, p.curToken.Line, p.curToken.Column)
+		p.Errors = append(p.Errors, msg)
+		return nil
+	}
+	return &ast.ByteSizeValue{Token: p.curToken, Value: n}
+}
+
+func (p *Parser) parseTimestampValue() ast.Value {
+	t, err := time.Parse(time.RFC3339Nano, p.curToken.Literal)
+	if err != nil {
+		msg := fmt.Sprintf("Error: invalid timestamp %s - line %d column %d",
+			p.curToken.Literal, p.curToken.Line, p.curToken.Column)
+		p.Errors = append(p.Errors, msg)
+		return nil
+	}
+	return &ast.TimestampValue{Token: p.curToken, Value: t}
+}
+
 func (p *Parser) parseArrayValue() ast.Value {
 	arrayValue := &ast.ArrayValue{Token: p.curToken, Values: []ast.Value{}}
 
@@ -119,8 +533,12 @@ func (p *Parser) parseArrayValue() ast.Value {
 		return arrayValue
 	}
 
+	if p.peekTokenIs(token.FOR) {
+		return p.parseArrayComprehension()
+	}
+
 	p.nextToken()
-	value := p.parseValue()
+	value := p.parseArrayElement()
 	if value != nil {
 		arrayValue.Values = append(arrayValue.Values, value)
 	} else {
@@ -130,7 +548,7 @@ func (p *Parser) parseArrayValue() ast.Value {
 	for p.peekTokenIs(token.COMMA) {
 		p.nextToken()
 		p.nextToken()
-		value := p.parseValue()
+		value := p.parseArrayElement()
 		if value != nil {
 			arrayValue.Values = append(arrayValue.Values, value)
 		} else {
@@ -145,6 +563,21 @@ func (p *Parser) parseArrayValue() ast.Value {
 	return arrayValue
 }
 
+// parseArrayElement parses a value of an array literal, or a ...spread.
+func (p *Parser) parseArrayElement() ast.Value {
+	if !p.curTokenIs(token.ELLIPSIS) {
+		return p.parseValue()
+	}
+
+	spread := &ast.SpreadElement{Token: p.curToken}
+	p.nextToken()
+	spread.Value = p.parseValue()
+	if spread.Value == nil {
+		return nil
+	}
+	return spread
+}
+
 func (p *Parser) parseObjectValue() ast.Value {
 	objectValue := &ast.ObjectValue{Token: p.curToken, Attributes: []ast.Attribute{}}
 
@@ -153,37 +586,533 @@ func (p *Parser) parseObjectValue() ast.Value {
 		return objectValue
 	}
 
-	att := ast.Attribute{}
-	// Skip the left brace, curToken is the Key (STRING)
+	if p.peekTokenIs(token.FOR) {
+		return p.parseObjectComprehension()
+	}
+
+	p.objects = append(p.objects, objectValue)
+	defer func() { p.objects = p.objects[:len(p.objects)-1] }()
+
+	// Skip the left brace, curToken is the Key
 	p.nextToken()
-	att.Key = p.curToken.Literal
-	// Skip the key, curToken is a colon
+	if !p.parseObjectMember(objectValue) {
+		return nil
+	}
+
+	for p.peekTokenIs(token.COMMA) {
+		// Skip the curToken, curToken is now the comma
+		p.nextToken()
+		// Skip the comma, curToken is the Key
+		p.nextToken()
+		if !p.parseObjectMember(objectValue) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+
+	return objectValue
+}
+
+// parseObjectMember parses an attribute, an assertion or a pattern of
+// objectValue.
+func (p *Parser) parseObjectMember(objectValue *ast.ObjectValue) bool {
+	if p.curTokenIs(token.ASSERT) {
+		assertion := p.parseAssertion()
+		if assertion == nil {
+			return false
+		}
+		objectValue.Assertions = append(objectValue.Assertions, assertion)
+		return true
+	}
+	if p.curTokenIs(token.LBRACKET) {
+		return p.parseBracketMember(objectValue)
+	}
+
+	att, ok := p.parseAttribute()
+	if !ok {
+		return false
+	}
+	objectValue.Attributes = append(objectValue.Attributes, att)
+	return true
+}
+
+// parseBracketMember parses [name=constraint]: value, where name= can be left
+// out, as a pattern of objectValue. Without a name and a constraint operator,
+// [expr]: value is an attribute whose key is computed from expr, which can
+// still turn out to be a constraint such as string once evaluated.
+func (p *Parser) parseBracketMember(objectValue *ast.ObjectValue) bool {
+	tok := p.curToken
+
+	p.nextToken()
+	var name *ast.Identifier
+	if p.curTokenIs(token.IDENT) && p.peekTokenIs(token.ASSIGN) {
+		name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		p.nextToken()
+		p.nextToken()
+	}
+
+	expr := p.parseExpression(LOWEST)
+	if expr == nil || !p.expectPeek(token.RBRACKET) {
+		return false
+	}
+
+	if name == nil && !isConstraintExpression(expr) {
+		att, ok := p.parseAttributeValue(ast.Attribute{Token: tok, Computed: expr})
+		if !ok {
+			return false
+		}
+		objectValue.Attributes = append(objectValue.Attributes, att)
+		return true
+	}
+
+	pattern := &ast.Pattern{Token: tok, Name: name, Constraint: expr}
+	if !p.expectPeek(token.COLON) {
+		return false
+	}
+	p.nextToken()
+	pattern.Value = p.parseValue()
+	if pattern.Value == nil {
+		return false
+	}
+	objectValue.Patterns = append(objectValue.Patterns, pattern)
+	return true
+}
+
+// isConstraintExpression reports whether v is a bound, a disjunction or a
+// conjunction.
+func isConstraintExpression(v ast.Value) bool {
+	switch v := v.(type) {
+	case *ast.BoundExpression:
+		return true
+	case *ast.InfixExpression:
+		return v.Operator == "|" || v.Operator == "&"
+	}
+	return false
+}
+
+// parseAssertion parses assert condition, optionally followed by : message.
+func (p *Parser) parseAssertion() *ast.Assertion {
+	assertion := &ast.Assertion{Token: p.curToken}
+
 	p.nextToken()
+	assertion.Condition = p.parseExpression(LOWEST)
+	if assertion.Condition == nil {
+		return nil
+	}
+
+	if p.peekTokenIs(token.COLON) {
+		p.nextToken()
+		p.nextToken()
+		assertion.Message = p.parseExpression(LOWEST)
+		if assertion.Message == nil {
+			return nil
+		}
+	}
+
+	return assertion
+}
+
+// parseParam parses param name, optionally followed by = default.
+func (p *Parser) parseParam() *ast.Parameter {
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	param := &ast.Parameter{Name: &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}}
+
+	if p.peekTokenIs(token.ASSIGN) {
+		p.nextToken()
+		p.nextToken()
+		param.Default = p.parseExpression(LOWEST)
+		if param.Default == nil {
+			return nil
+		}
+	}
+
+	return param
+}
+
+// parseExport parses export name, name, ...
+func (p *Parser) parseExport() []*ast.Identifier {
+	exports := []*ast.Identifier{}
+	for {
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		exports = append(exports, &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
+		if !p.peekTokenIs(token.COMMA) {
+			return exports
+		}
+		p.nextToken()
+	}
+}
+
+// parseProfile parses profile name overlay.
+func (p *Parser) parseProfile() *ast.Profile {
+	profile := &ast.Profile{Token: p.curToken}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	profile.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	p.nextToken()
+	profile.Overlay = p.parseExpression(LOWEST)
+	if profile.Overlay == nil {
+		return nil
+	}
+
+	return profile
+}
+
+// parseAttribute parses a "key: value" pair or a "...spread". The key is either
+// a string or a bare identifier, and can be followed by a merge marker: "+:"
+// appends to the value being overridden and "!:" replaces it. A double colon
+// makes the attribute hidden.
+func (p *Parser) parseAttribute() (ast.Attribute, bool) {
+	att := ast.Attribute{Token: p.curToken, Key: p.curToken.Literal}
+
+	if p.curTokenIs(token.ELLIPSIS) {
+		att.Key = ""
+		att.Spread = true
+		p.nextToken()
+		att.V = p.parseValue()
+		return att, att.V != nil
+	}
+	if p.curTokenIs(token.STRING) {
+		att.Key = ast.Unescape(p.curToken.Literal)
+	}
+
+	if !p.curTokenIs(token.STRING) && !p.curTokenIs(token.IDENT) {
+		msg := fmt.Sprintf("Error: unexpected token %s as object key - line %d column %d",
+			p.curToken.Literal, p.curToken.Line, p.curToken.Column)
+		p.Errors = append(p.Errors, msg)
+		return att, false
+	}
+
+	return p.parseAttributeValue(att)
+}
+
+// parseAttributeValue parses the merge marker, the colon and the value that
+// follow the key of att.
+func (p *Parser) parseAttributeValue(att ast.Attribute) (ast.Attribute, bool) {
+	switch {
+	case p.peekTokenIs(token.PLUS):
+		att.Merge = ast.MergeAppend
+		p.nextToken()
+	case p.peekTokenIs(token.BANG):
+		att.Merge = ast.MergeReplace
+		p.nextToken()
+	}
+
+	// Skip the key, curToken is a colon
+	if p.peekTokenIs(token.DOUBLE_COLON) {
+		att.Hidden = true
+		p.nextToken()
+	} else if !p.expectPeek(token.COLON) {
+		return att, false
+	}
 	// Skip the colon
 	p.nextToken()
 	att.V = p.parseValue()
-	objectValue.Attributes = append(objectValue.Attributes, att)
 
-	for p.peekTokenIs(token.COMMA) {
-		att := ast.Attribute{}
-		// Skip the curToken, curToken is now the comma
+	return att, att.V != nil
+}
+
+func (p *Parser) parseIfExpression() ast.Value {
+	expression := &ast.IfExpression{Token: p.curToken}
+
+	p.nextToken()
+	expression.Condition = p.parseExpression(LOWEST)
+	if expression.Condition == nil || !p.expectPeek(token.THEN) {
+		return nil
+	}
+
+	p.nextToken()
+	expression.Consequence = p.parseExpression(LOWEST)
+	if expression.Consequence == nil || !p.expectPeek(token.ELSE) {
+		return nil
+	}
+
+	p.nextToken()
+	expression.Alternative = p.parseExpression(LOWEST)
+	if expression.Alternative == nil {
+		return nil
+	}
+
+	return expression
+}
+
+// parseTryExpression parses try value else fallback, where value can be
+// followed by as name.
+func (p *Parser) parseTryExpression() ast.Value {
+	expression := &ast.TryExpression{Token: p.curToken}
+
+	p.nextToken()
+	expression.Value = p.parseExpression(LOWEST)
+	if expression.Value == nil {
+		return nil
+	}
+
+	if p.peekToken.Type == token.IDENT && p.peekToken.Literal == "as" {
+		p.nextToken()
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		expression.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	}
+	if !p.expectPeek(token.ELSE) {
+		return nil
+	}
+
+	p.nextToken()
+	expression.Fallback = p.parseExpression(LOWEST)
+	if expression.Fallback == nil {
+		return nil
+	}
+
+	return expression
+}
+
+// parseFunctionLiteral parses function(a, b = default) body.
+func (p *Parser) parseFunctionLiteral() ast.Value {
+	lit := &ast.FunctionLiteral{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	params, ok := p.parseFunctionParameters()
+	if !ok {
+		return nil
+	}
+	lit.Parameters = params
+
+	p.nextToken()
+	lit.Body = p.parseExpression(LOWEST)
+	if lit.Body == nil {
+		return nil
+	}
+
+	return lit
+}
+
+func (p *Parser) parseFunctionParameters() ([]*ast.Parameter, bool) {
+	params := []*ast.Parameter{}
+
+	if p.peekTokenIs(token.RPAREN) {
+		p.nextToken()
+		return params, true
+	}
+
+	for {
+		if !p.expectPeek(token.IDENT) {
+			return nil, false
+		}
+		param := &ast.Parameter{Name: &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}}
+
+		if p.peekTokenIs(token.ASSIGN) {
+			p.nextToken()
+			p.nextToken()
+			param.Default = p.parseExpression(LOWEST)
+			if param.Default == nil {
+				return nil, false
+			}
+		} else if len(params) > 0 && params[len(params)-1].Default != nil {
+			msg := fmt.Sprintf("Error: parameter %s without default follows one with a default - line %d column %d",
+				param.Name.Value, param.Name.Token.Line, param.Name.Token.Column)
+			p.Errors = append(p.Errors, msg)
+			return nil, false
+		}
+		params = append(params, param)
+
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
 		p.nextToken()
-		// Skip the comma, curToken is the Key (STRING)
+	}
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil, false
+	}
+
+	return params, true
+}
+
+// parseImportExpression parses import "path".
+func (p *Parser) parseImportExpression() ast.Value {
+	expression := &ast.ImportExpression{Token: p.curToken}
+
+	if !p.expectPeek(token.STRING) {
+		return nil
+	}
+	expression.Path = p.parseStringValue().(*ast.StringValue)
+
+	return expression
+}
+
+func (p *Parser) parseCallExpression(function ast.Value) ast.Value {
+	expression := &ast.CallExpression{Token: p.curToken, Function: function}
+
+	args, ok := p.parseCallArguments()
+	if !ok {
+		return nil
+	}
+	expression.Arguments = args
+
+	return expression
+}
+
+// parseCallArguments parses positional arguments followed by named ones
+// (name = value).
+func (p *Parser) parseCallArguments() ([]*ast.Argument, bool) {
+	args := []*ast.Argument{}
+
+	if p.peekTokenIs(token.RPAREN) {
 		p.nextToken()
-		att.Key = p.curToken.Literal
-		// Skip the key, curToken is a colon
+		return args, true
+	}
+
+	for {
 		p.nextToken()
-		// Skip the colon
+		arg := &ast.Argument{}
+
+		if p.curTokenIs(token.IDENT) && p.peekTokenIs(token.ASSIGN) {
+			arg.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+			p.nextToken()
+			p.nextToken()
+		} else if len(args) > 0 && args[len(args)-1].Name != nil {
+			msg := fmt.Sprintf("Error: positional argument follows named argument - line %d column %d",
+				p.curToken.Line, p.curToken.Column)
+			p.Errors = append(p.Errors, msg)
+			return nil, false
+		}
+
+		arg.Value = p.parseExpression(LOWEST)
+		if arg.Value == nil {
+			return nil, false
+		}
+		args = append(args, arg)
+
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
 		p.nextToken()
-		att.V = p.parseValue()
-		objectValue.Attributes = append(objectValue.Attributes, att)
+	}
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil, false
+	}
+
+	return args, true
+}
+
+// parseArrayComprehension parses [for x in list: expr if cond]. curToken is the
+// left bracket.
+func (p *Parser) parseArrayComprehension() ast.Value {
+	comprehension := &ast.ArrayComprehension{Token: p.curToken}
+
+	p.nextToken()
+	comprehension.For = p.parseForClause()
+	if comprehension.For == nil {
+		return nil
+	}
+
+	p.nextToken()
+	comprehension.Body = p.parseValue()
+	if comprehension.Body == nil || !p.parseForFilter(comprehension.For) {
+		return nil
+	}
+
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+
+	return comprehension
+}
+
+// parseObjectComprehension parses {for k, v in obj: key: value if cond}.
+// curToken is the left brace.
+func (p *Parser) parseObjectComprehension() ast.Value {
+	comprehension := &ast.ObjectComprehension{Token: p.curToken}
+
+	p.nextToken()
+	comprehension.For = p.parseForClause()
+	if comprehension.For == nil {
+		return nil
+	}
+
+	p.nextToken()
+	comprehension.Key = p.parseValue()
+	if comprehension.Key == nil {
+		return nil
+	}
+
+	if !p.expectPeek(token.COLON) {
+		return nil
+	}
+
+	p.nextToken()
+	comprehension.Body = p.parseValue()
+	if comprehension.Body == nil || !p.parseForFilter(comprehension.For) {
+		return nil
 	}
 
 	if !p.expectPeek(token.RBRACE) {
 		return nil
 	}
 
-	return objectValue
+	return comprehension
+}
+
+// parseForClause parses "for k, v in iterable:". curToken is FOR and is left
+// on the colon.
+func (p *Parser) parseForClause() *ast.ForClause {
+	clause := &ast.ForClause{Token: p.curToken}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	clause.Value = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		clause.Key = clause.Value
+		clause.Value = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	}
+
+	if !p.expectPeek(token.IN) {
+		return nil
+	}
+
+	p.nextToken()
+	clause.Iterable = p.parseValue()
+	if clause.Iterable == nil {
+		return nil
+	}
+
+	if !p.expectPeek(token.COLON) {
+		return nil
+	}
+
+	return clause
+}
+
+// parseForFilter parses the optional "if cond" ending a comprehension.
+func (p *Parser) parseForFilter(clause *ast.ForClause) bool {
+	if !p.peekTokenIs(token.IF) {
+		return true
+	}
+	p.nextToken()
+	p.nextToken()
+	clause.Filter = p.parseValue()
+
+	return clause.Filter != nil
 }
 
 func (p *Parser) parseBooleanValue() ast.Value {
@@ -194,6 +1123,27 @@ func (p *Parser) parseBooleanValue() ast.Value {
 	return expression
 }
 
+// parseSelfExpression parses self or super, which marks the object literal
+// they are written in as Late.
+func (p *Parser) parseSelfExpression() ast.Value {
+	if len(p.objects) == 0 {
+		msg := fmt.Sprintf("Error: %s outside of an object - line %d column %d",
+			p.curToken.Literal, p.curToken.Line, p.curToken.Column)
+		p.Errors = append(p.Errors, msg)
+		return nil
+	}
+	p.objects[len(p.objects)-1].Late = true
+
+	if p.curTokenIs(token.SUPER) {
+		return &ast.SuperExpression{Token: p.curToken}
+	}
+	return &ast.SelfExpression{Token: p.curToken}
+}
+
+func (p *Parser) parseNullValue() ast.Value {
+	return &ast.NullValue{Token: p.curToken}
+}
+
 func (p *Parser) curTokenIs(t token.TokenType) bool {
 	return p.curToken.Type == t
 }
@@ -207,7 +1157,13 @@ func (p *Parser) expectPeek(t token.TokenType) bool {
 		p.nextToken()
 		return true
 	} else {
-		// p.peekError(t)
+		p.peekError(t)
 		return false
 	}
 }
+
+func (p *Parser) peekError(t token.TokenType) {
+	msg := fmt.Sprintf("Error: expected next token to be %s, got %s instead - line %d column %d",
+		t, p.peekToken.Type, p.peekToken.Line, p.peekToken.Column)
+	p.Errors = append(p.Errors, msg)
+}
@@ -1,6 +1,8 @@
 package parser
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"testing"
 
@@ -208,3 +210,464 @@ func testLiteralValue(
 	t.Errorf("type of exp not handled. got=%T", obj)
 	return false
 }
+
+func TestOperatorPrecedence(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 + 2 * 3", "(1 + (2 * 3))\n"},
+		{"-a + b", "((-a) + b)\n"},
+		{"a - 1", "(a - 1)\n"},
+		{"!a || b && c", "((!a) || (b && c))\n"},
+		{"a.b.c == 3 - -1", "(a.b.c == (3 - -1))\n"},
+		{"(1 + 2) * 3", "((1 + 2) * 3)\n"},
+		{"a < b != c >= d", "((a < b) != (c >= d))\n"},
+		{"a?.b.c ?? x || y ?? null", "((a?.b.c ?? (x || y)) ?? null)\n"},
+		{"a[0].b[1:] + -s[:n - 1][-1]", "(a[0].b[1:] + (-s[:(n - 1)][-1]))\n"},
+		{"f(x)[i]?.[j]", "f(x)[i]?.[j]\n"},
+		{"a\n[1]", "a\n[1]\n"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		document := p.ParseDocument()
+		if document == nil {
+			t.Fatalf("%q: parser errors %v", tt.input, p.Errors)
+		}
+
+		actual := document.String()
+		if actual != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, actual)
+		}
+	}
+}
+
+func TestComprehension(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[for x in xs: x * 2]", "[for x in xs: (x * 2)]"},
+		{"[for i, x in xs: i if x > 1]", "[for i, x in xs: i if (x > 1)]"},
+		{"{for k, v in obj: k: v}", "{for k, v in obj: k:v}"},
+		{"{for s in list: s.name: s if s.on}", "{for s in list: s.name:s if s.on}"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		document := p.ParseDocument()
+		if document == nil {
+			t.Fatalf("%q: parser errors %v", tt.input, p.Errors)
+		}
+
+		if len(document.Values) != 1 {
+			t.Fatalf("document.Values does not contain 1 value. got=%d",
+				len(document.Values))
+		}
+
+		actual := document.Values[0].String()
+		if actual != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, actual)
+		}
+	}
+}
+
+func TestFunctionLiteral(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"function(name, port = 80) {\"name\": name}", "function(name, port = 80) {\"name\":name}"},
+		{"f(1, port = 2)", "f(1, port = 2)"},
+		{"a.b(1)(2)", "a.b(1)(2)"},
+		{"if a then 1 else f(2)", "if a then 1 else f(2)"},
+		{"function() 1 + 2", "function() (1 + 2)"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		document := p.ParseDocument()
+		if document == nil {
+			t.Fatalf("%q: parser errors %v", tt.input, p.Errors)
+		}
+
+		actual := document.Values[0].String()
+		if actual != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, actual)
+		}
+	}
+}
+
+func TestFunctionErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"function(a = 1, b) a", "Error: parameter b without default follows one with a default - line 1 column 17"},
+		{"f(a = 1, 2)", "Error: positional argument follows named argument - line 1 column 10"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		document := p.ParseDocument()
+		if document != nil {
+			t.Fatalf("%q: expected a parser error", tt.input)
+		}
+
+		if len(p.Errors) == 0 || p.Errors[0] != tt.expected {
+			t.Errorf("expected=%q, got=%v", tt.expected, p.Errors)
+		}
+	}
+}
+
+func TestAttributeMarkers(t *testing.T) {
+	l := lexer.New(`{a: 1, b+: [2], c!: {}, ...d}`)
+	p := New(l)
+	document := p.ParseDocument()
+	if document == nil {
+		t.Fatalf("parser errors %v", p.Errors)
+	}
+
+	objectValue, ok := document.Values[0].(*ast.ObjectValue)
+	if !ok {
+		t.Fatalf("stmt not *ast.ObjectValue. got=%T", document.Values[0])
+	}
+
+	tests := []struct {
+		key    string
+		merge  ast.MergeMode
+		spread bool
+	}{
+		{"a", ast.MergeDeep, false},
+		{"b", ast.MergeAppend, false},
+		{"c", ast.MergeReplace, false},
+		{"", ast.MergeDeep, true},
+	}
+
+	for i, tt := range tests {
+		att := objectValue.Attributes[i]
+		if att.Key != tt.key || att.Merge != tt.merge || att.Spread != tt.spread {
+			t.Errorf("attributes[%d]: expected=%v, got=%v", i, tt, att)
+		}
+	}
+}
+
+func TestConstraintExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"int & >=1 & <=65535", "((int & >=1) & <=65535)"},
+		{"\"debug\" | *\"info\" | \"warn\"", "((\"debug\" | *\"info\") | \"warn\")"},
+		{"int & >=1 | *8080", "((int & >=1) | *8080)"},
+		{"!=\"\" & string", "(!=\"\" & string)"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		document := p.ParseDocument()
+		if document == nil {
+			t.Fatalf("%q: parser errors %v", tt.input, p.Errors)
+		}
+
+		actual := document.Values[0].String()
+		if actual != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, actual)
+		}
+	}
+}
+
+func TestHiddenAttribute(t *testing.T) {
+	l := lexer.New(`{a:: 1, b: 2, c+:: [3]}`)
+	p := New(l)
+	document := p.ParseDocument()
+	if document == nil {
+		t.Fatalf("parser errors %v", p.Errors)
+	}
+
+	objectValue := document.Values[0].(*ast.ObjectValue)
+	expected := []bool{true, false, true}
+	for i, hidden := range expected {
+		if objectValue.Attributes[i].Hidden != hidden {
+			t.Errorf("attributes[%d].Hidden: expected=%v, got=%v", i, hidden, objectValue.Attributes[i].Hidden)
+		}
+	}
+	if objectValue.Attributes[2].Merge != ast.MergeAppend {
+		t.Errorf("attributes[2].Merge: expected=%v, got=%v", ast.MergeAppend, objectValue.Attributes[2].Merge)
+	}
+}
+
+func TestAssertion(t *testing.T) {
+	l := lexer.New("{a: 1, assert a > 0 : \"positive\", b: 2}\nassert true")
+	p := New(l)
+	document := p.ParseDocument()
+	if document == nil {
+		t.Fatalf("parser errors %v", p.Errors)
+	}
+
+	if len(document.Values) != 1 || len(document.Assertions) != 1 {
+		t.Fatalf("expected 1 value and 1 assertion, got=%d and %d", len(document.Values), len(document.Assertions))
+	}
+	if document.Assertions[0].String() != "assert true" {
+		t.Errorf("expected=%q, got=%q", "assert true", document.Assertions[0].String())
+	}
+
+	objectValue := document.Values[0].(*ast.ObjectValue)
+	if len(objectValue.Attributes) != 2 || len(objectValue.Assertions) != 1 {
+		t.Fatalf("expected 2 attributes and 1 assertion, got=%d and %d", len(objectValue.Attributes), len(objectValue.Assertions))
+	}
+	expected := `assert (a > 0) : "positive"`
+	if objectValue.Assertions[0].String() != expected {
+		t.Errorf("expected=%q, got=%q", expected, objectValue.Assertions[0].String())
+	}
+}
+
+func TestParseContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	l := lexer.New(`{a: 1, b: [1, 2]}`)
+	_, err := New(l).ParseContext(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected a canceled error, got=%v", err)
+	}
+}
+
+func TestParam(t *testing.T) {
+	l := lexer.New("param env\nparam replicas = 1 + 1\n{env: env}")
+	p := New(l)
+	document := p.ParseDocument()
+	if document == nil {
+		t.Fatalf("parser errors %v", p.Errors)
+	}
+
+	expected := []string{"env", "replicas = (1 + 1)"}
+	if len(document.Params) != len(expected) {
+		t.Fatalf("expected %d params, got=%d", len(expected), len(document.Params))
+	}
+	for i, e := range expected {
+		if document.Params[i].String() != e {
+			t.Errorf("params[%d]: expected=%q, got=%q", i, e, document.Params[i].String())
+		}
+	}
+}
+
+func TestProfile(t *testing.T) {
+	l := lexer.New("{a: 1}\nprofile prod {a: 2}")
+	p := New(l)
+	document := p.ParseDocument()
+	if document == nil {
+		t.Fatalf("parser errors %v", p.Errors)
+	}
+
+	if len(document.Profiles) != 1 {
+		t.Fatalf("expected 1 profile, got=%d", len(document.Profiles))
+	}
+	expected := `profile prod {"a":2}`
+	if document.Profiles[0].String() != expected {
+		t.Errorf("expected=%q, got=%q", expected, document.Profiles[0].String())
+	}
+}
+
+func TestUnitValues(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1h30m", "1h30m"},
+		{"512MiB", "512MiB"},
+		{"2026-01-01T00:00:00Z", "2026-01-01T00:00:00Z"},
+		{"3q", "Error: invalid duration 3q - line 1 column 1"},
+		{"5xB", "Error: unknown unit xB in byte size 5xB - line 1 column 1"},
+		{"2026-13-01T00:00:00Z", "Error: invalid timestamp 2026-13-01T00:00:00Z - line 1 column 1"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		document := p.ParseDocument()
+		if document == nil {
+			if len(p.Errors) == 0 || p.Errors[0] != tt.expected {
+				t.Errorf("%q: expected=%q, got=%v", tt.input, tt.expected, p.Errors)
+			}
+			continue
+		}
+
+		if document.Values[0].String() != tt.expected {
+			t.Errorf("%q: expected=%q, got=%q", tt.input, tt.expected, document.Values[0].String())
+		}
+	}
+}
+
+func TestRegexValue(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`re"^v\d+$"`, `re"^v\d+$"`},
+		{`re"(a"`, `Error: invalid regex re"(a": missing closing ) - line 1 column 1`},
+		{`{a: re"x**"}`, `Error: invalid regex re"x**": invalid nested repetition operator - line 1 column 5`},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		document := p.ParseDocument()
+		if document == nil {
+			if len(p.Errors) == 0 || p.Errors[0] != tt.expected {
+				t.Errorf("%q: expected=%q, got=%v", tt.input, tt.expected, p.Errors)
+			}
+			continue
+		}
+
+		if document.Values[0].String() != tt.expected {
+			t.Errorf("%q: expected=%q, got=%q", tt.input, tt.expected, document.Values[0].String())
+		}
+	}
+}
+
+func TestImportDeclaration(t *testing.T) {
+	l := lexer.New("import \"lib/k8s\" as k8s\nexport web, as\nimport \"base.ynt\" + {as: 1}")
+	p := New(l)
+	document := p.ParseDocument()
+	if document == nil {
+		t.Fatalf("parser errors %v", p.Errors)
+	}
+
+	if len(document.Imports) != 1 || document.Imports[0].String() != `import "lib/k8s" as k8s` {
+		t.Errorf("expected the import of lib/k8s as k8s, got=%v", document.Imports)
+	}
+	if len(document.Exports) != 2 || document.Exports[0].Value != "web" || document.Exports[1].Value != "as" {
+		t.Errorf("expected the exports web and as, got=%v", document.Exports)
+	}
+	expected := `(import "base.ynt" + {"as":1})`
+	if len(document.Values) != 1 || document.Values[0].String() != expected {
+		t.Errorf("expected=%q, got=%v", expected, document.Values)
+	}
+}
+
+func TestPattern(t *testing.T) {
+	l := lexer.New(`{[name=string]: {replicas: 1}, [!="x"]: {}, web: {}}`)
+	p := New(l)
+	document := p.ParseDocument()
+	if document == nil {
+		t.Fatalf("parser errors %v", p.Errors)
+	}
+
+	ov, ok := document.Values[0].(*ast.ObjectValue)
+	if !ok || len(ov.Patterns) != 2 || len(ov.Attributes) != 1 {
+		t.Fatalf("expected an object with 2 patterns and 1 field, got=%v", document.Values[0])
+	}
+	expected := `{"web":{}, [name=string]:{"replicas":1}, [!="x"]:{}}`
+	if ov.String() != expected {
+		t.Errorf("expected=%q, got=%q", expected, ov.String())
+	}
+}
+
+func TestComputedKey(t *testing.T) {
+	l := lexer.New(`{[prefix + "_url"]: 1, ["b"]+: [2], [string]: {}, [>"m"]: {}}`)
+	p := New(l)
+	document := p.ParseDocument()
+	if document == nil {
+		t.Fatalf("parser errors %v", p.Errors)
+	}
+
+	ov, ok := document.Values[0].(*ast.ObjectValue)
+	if !ok || len(ov.Attributes) != 3 || len(ov.Patterns) != 1 {
+		t.Fatalf("expected an object with 3 fields and 1 pattern, got=%v", document.Values[0])
+	}
+	if ov.Attributes[1].Merge != ast.MergeAppend {
+		t.Errorf("expected [\"b\"]+: to append, got=%v", ov.Attributes[1].Merge)
+	}
+	expected := `{[(prefix + "_url")]:1, ["b"]:[2], [string]:{}, [>"m"]:{}}`
+	if ov.String() != expected {
+		t.Errorf("expected=%q, got=%q", expected, ov.String())
+	}
+}
+
+func TestArraySpread(t *testing.T) {
+	l := lexer.New(`[0, ...a, ...[1, 2]]`)
+	p := New(l)
+	document := p.ParseDocument()
+	if document == nil {
+		t.Fatalf("parser errors %v", p.Errors)
+	}
+
+	av, ok := document.Values[0].(*ast.ArrayValue)
+	if !ok || len(av.Values) != 3 {
+		t.Fatalf("expected an array of 3 values, got=%v", document.Values[0])
+	}
+	if _, ok := av.Values[1].(*ast.SpreadElement); !ok {
+		t.Errorf("expected a spread, got=%T", av.Values[1])
+	}
+	expected := `[0, ...a, ...[1, 2]]`
+	if av.String() != expected {
+		t.Errorf("expected=%q, got=%q", expected, av.String())
+	}
+}
+
+func TestSelfExpression(t *testing.T) {
+	l := lexer.New(`{a: 1, b: {c: self.a, d: super.d}}`)
+	p := New(l)
+	document := p.ParseDocument()
+	if document == nil {
+		t.Fatalf("parser errors %v", p.Errors)
+	}
+
+	outer := document.Values[0].(*ast.ObjectValue)
+	inner, ok := outer.Attributes[1].V.(*ast.ObjectValue)
+	if !ok || outer.Late || !inner.Late {
+		t.Fatalf("expected only the inner object to be late, got=%v %v", outer.Late, inner.Late)
+	}
+	expected := `{"c":self.a, "d":super.d}`
+	if inner.String() != expected {
+		t.Errorf("expected=%q, got=%q", expected, inner.String())
+	}
+
+	l = lexer.New(`self.a`)
+	p = New(l)
+	p.ParseDocument()
+	expected = "Error: self outside of an object - line 1 column 1"
+	if len(p.Errors) == 0 || p.Errors[0] != expected {
+		t.Errorf("expected error %q, got=%v", expected, p.Errors)
+	}
+}
+
+func TestTryExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`try a.b else 1`, `try a.b else 1`},
+		{`try f(1) as e else e`, `try f(1) as e else e`},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		document := p.ParseDocument()
+		if document == nil {
+			t.Fatalf("parser errors %v", p.Errors)
+		}
+		te, ok := document.Values[0].(*ast.TryExpression)
+		if !ok {
+			t.Fatalf("expected *ast.TryExpression, got=%T", document.Values[0])
+		}
+		if te.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, te.String())
+		}
+	}
+
+	l := lexer.New(`try a`)
+	p := New(l)
+	p.ParseDocument()
+	if len(p.Errors) == 0 {
+		t.Errorf("expected an error for a try without else")
+	}
+}
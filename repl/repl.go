@@ -4,9 +4,11 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"os"
 
 	"github.com/salleaffaire/ynt/parser"
 
+	"github.com/salleaffaire/ynt/evaluator"
 	"github.com/salleaffaire/ynt/lexer"
 )
 
@@ -51,8 +53,16 @@ func Start(in io.Reader, out io.Writer) {
 			// }
 
 			if document != nil {
-				io.WriteString(out, document.String())
-				io.WriteString(out, "\n")
+				value, err := evaluator.New(evaluator.WithFS(os.DirFS("."))).EvalDocument(document)
+				if err != nil {
+					io.WriteString(out, err.Error())
+					io.WriteString(out, "\n")
+					continue
+				}
+				if value != nil {
+					io.WriteString(out, value.String())
+					io.WriteString(out, "\n")
+				}
 			}
 		}
 	}
@@ -8,23 +8,94 @@ const (
 	IDENT  = "IDENT"
 	NUMBER = "NUMBER"
 	STRING = "STRING"
+	REGEX  = "REGEX"
+
+	DURATION  = "DURATION"
+	BYTESIZE  = "BYTESIZE"
+	TIMESTAMP = "TIMESTAMP"
+
+	// Operators
+	PLUS     = "+"
+	MINUS    = "-"
+	ASTERISK = "*"
+	SLASH    = "/"
+	PERCENT  = "%"
+	BANG     = "!"
+	ASSIGN   = "="
+
+	EQ     = "=="
+	NOT_EQ = "!="
+	LT     = "<"
+	GT     = ">"
+	LT_EQ  = "<="
+	GT_EQ  = ">="
+
+	AND = "&&"
+	OR  = "||"
+
+	QUESTION_DOT = "?."
+	COALESCE     = "??"
+
+	// Constraints
+	AMPERSAND = "&"
+	PIPE      = "|"
 
 	// Delimiters
 	COMMA = ","
 	COLON = ":"
 
+	DOUBLE_COLON = "::"
+	DOT          = "."
+
+	ELLIPSIS = "..."
+
+	LPAREN   = "("
+	RPAREN   = ")"
 	LBRACE   = "{"
 	RBRACE   = "}"
 	LBRACKET = "["
 	RBRACKET = "]"
 
+	// Keywords
 	TRUE  = "TRUE"
 	FALSE = "FALSE"
+	NULL  = "NULL"
+	FOR   = "FOR"
+	IN    = "IN"
+	IF    = "IF"
+	THEN  = "THEN"
+	ELSE  = "ELSE"
+
+	FUNCTION = "FUNCTION"
+	IMPORT   = "IMPORT"
+	ASSERT   = "ASSERT"
+	PARAM    = "PARAM"
+	PROFILE  = "PROFILE"
+	EXPORT   = "EXPORT"
+	SELF     = "SELF"
+	SUPER    = "SUPER"
+	TRY      = "TRY"
 )
 
 var keywords = map[string]TokenType{
 	"true":  TRUE,
 	"false": FALSE,
+	"null":  NULL,
+	"for":   FOR,
+	"in":    IN,
+	"if":    IF,
+	"then":  THEN,
+	"else":  ELSE,
+
+	"function": FUNCTION,
+	"import":   IMPORT,
+	"assert":   ASSERT,
+	"param":    PARAM,
+	"profile":  PROFILE,
+	"export":   EXPORT,
+	"self":     SELF,
+	"super":    SUPER,
+	"try":      TRY,
 }
 
 type TokenType string
@@ -32,6 +103,10 @@ type TokenType string
 type Token struct {
 	Type    TokenType
 	Literal string
+
+	// Position of the first character of the token in the source
+	Line   int
+	Column int
 }
 
 func LookupIdent(s string) TokenType {